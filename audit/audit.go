@@ -0,0 +1,380 @@
+package audit
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/best-expendables-v2/common-utils/model"
+	"github.com/best-expendables-v2/common-utils/util"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+
+	defaultTable        = "audit_records"
+	defaultMaxWhereRows = 1000
+	oldRowsKey          = "audit:old_rows"
+)
+
+// ErrTooManyRows fails an update or delete by conditions matching more rows
+// than Config.MaxWhereRows, rather than leaving them unaudited.
+var ErrTooManyRows = errors.New("audit: too many rows match the conditions")
+
+// Change is the value of a column before and after a write, Old is nil on
+// create and New is nil on delete.
+type Change struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// Changes maps the changed columns to their Change, stored as JSON.
+type Changes map[string]Change
+
+func (c Changes) Value() (driver.Value, error) {
+	b, err := json.Marshal(c)
+	return string(b), err
+}
+
+func (c *Changes) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	case nil:
+		*c = nil
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into audit.Changes", value)
+}
+
+// Record is a write to an entity, CreatedAt being when it happened.
+type Record struct {
+	model.BaseModel
+	EntityType string  `json:"entityType"`
+	EntityID   string  `json:"entityId"`
+	Action     string  `json:"action"`
+	ActorID    string  `json:"actorId"`
+	Changes    Changes `gorm:"type:text" json:"changes"`
+}
+
+type Config struct {
+	Table          string
+	Actor          func(ctx context.Context) string
+	IgnoredTables  []string
+	IgnoredColumns []string
+	// MaxWhereRows bounds the rows an update or delete by conditions may
+	// match, they are held in memory twice. 1000 by default.
+	MaxWhereRows int
+}
+
+type Option func(*Config)
+
+// WithTable sets the table of the records, "audit_records" by default.
+func WithTable(table string) Option {
+	return func(c *Config) {
+		c.Table = table
+	}
+}
+
+// WithActor replaces util.GetUserIDFromContext to tell who writes.
+func WithActor(actor func(ctx context.Context) string) Option {
+	return func(c *Config) {
+		c.Actor = actor
+	}
+}
+
+func WithIgnoredTables(tables ...string) Option {
+	return func(c *Config) {
+		c.IgnoredTables = append(c.IgnoredTables, tables...)
+	}
+}
+
+// WithMaxWhereRows sets Config.MaxWhereRows.
+func WithMaxWhereRows(max int) Option {
+	return func(c *Config) {
+		c.MaxWhereRows = max
+	}
+}
+
+// WithIgnoredColumns leaves columns, e.g. updated_at, out of the changes.
+func WithIgnoredColumns(columns ...string) Option {
+	return func(c *Config) {
+		c.IgnoredColumns = append(c.IgnoredColumns, columns...)
+	}
+}
+
+// Trail is a gorm plugin recording the creates, updates and deletes of
+// models with a primary key, and reads the records back. Records are
+// written on the statement's connection so they commit or roll back with
+// the write. Updates and deletes without the primary key of the model, e.g.
+// Where(...).Delete(&T{}), record the rows matching their conditions and
+// fail with ErrTooManyRows past Config.MaxWhereRows of them.
+//
+// Not audited are raw SQL, which includes the BulkInsert and BulkUpsert of
+// the repositories, updates or deletes of a slice of models, and creates
+// from maps without the primary key.
+type Trail struct {
+	config Config
+}
+
+func New(opts ...Option) *Trail {
+	config := Config{
+		Table:        defaultTable,
+		Actor:        util.GetUserIDFromContext,
+		MaxWhereRows: defaultMaxWhereRows,
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return &Trail{config: config}
+}
+
+func (t *Trail) Name() string {
+	return "gorm:audit"
+}
+
+func (t *Trail) Initialize(db *gorm.DB) error {
+	callback := db.Callback()
+	errs := []error{
+		callback.Create().After("gorm:create").Before("gorm:commit_or_rollback_transaction").Register("audit:after_create", t.afterCreate),
+		callback.Update().After("gorm:begin_transaction").Before("gorm:update").Register("audit:before_update", t.loadOldRows),
+		callback.Update().After("gorm:update").Before("gorm:commit_or_rollback_transaction").Register("audit:after_update", t.afterUpdate),
+		callback.Delete().After("gorm:begin_transaction").Before("gorm:delete").Register("audit:before_delete", t.loadOldRows),
+		callback.Delete().After("gorm:delete").Before("gorm:commit_or_rollback_transaction").Register("audit:after_delete", t.afterDelete),
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// History returns the records of m, oldest first.
+func (t *Trail) History(ctx context.Context, db *gorm.DB, m model.Model) ([]Record, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(m); err != nil {
+		return nil, err
+	}
+	return t.HistoryOf(ctx, db, stmt.Schema.Table, m.GetID())
+}
+
+// HistoryOf returns the records of the entity of table entityType with the
+// given id, oldest first.
+func (t *Trail) HistoryOf(ctx context.Context, db *gorm.DB, entityType, entityID string) ([]Record, error) {
+	var records []Record
+	err := db.WithContext(ctx).Table(t.config.Table).
+		Where("entity_type = ? AND entity_id = ?", entityType, entityID).
+		Order("created_at").
+		Find(&records).Error
+	return records, err
+}
+
+func (t *Trail) audited(db *gorm.DB) bool {
+	if db.Error != nil || db.Statement.Schema == nil || db.Statement.Schema.PrioritizedPrimaryField == nil {
+		return false
+	}
+	return db.Statement.Table != t.config.Table && !contains(t.config.IgnoredTables, db.Statement.Table)
+}
+
+func (t *Trail) afterCreate(db *gorm.DB) {
+	if !t.audited(db) {
+		return
+	}
+	rows := db.Statement.ReflectValue
+	if rows.Kind() == reflect.Struct || rows.Kind() == reflect.Map {
+		rows = reflect.Append(reflect.MakeSlice(reflect.SliceOf(rows.Type()), 0, 1), rows)
+	}
+	for i := 0; i < rows.Len(); i++ {
+		row := reflect.Indirect(rows.Index(i))
+		var id interface{}
+		var changes Changes
+		if values, ok := row.Interface().(map[string]interface{}); ok {
+			id, changes = t.createdMap(db, values)
+		} else {
+			id, changes = t.createdStruct(db, row)
+		}
+		if id != nil {
+			t.record(db, ActionCreate, id, changes)
+		}
+	}
+}
+
+func (t *Trail) createdStruct(db *gorm.DB, row reflect.Value) (interface{}, Changes) {
+	s := db.Statement.Schema
+	changes := Changes{}
+	for _, field := range s.Fields {
+		if field.DBName == "" || contains(t.config.IgnoredColumns, field.DBName) {
+			continue
+		}
+		value, _ := field.ValueOf(db.Statement.Context, row)
+		changes[field.DBName] = Change{New: value}
+	}
+	id, _ := s.PrioritizedPrimaryField.ValueOf(db.Statement.Context, row)
+	return id, changes
+}
+
+// createdMap reads a map create the way gorm does, keys being field or
+// column names. Its id is nil when the map has no primary key.
+func (t *Trail) createdMap(db *gorm.DB, values map[string]interface{}) (interface{}, Changes) {
+	s := db.Statement.Schema
+	var id interface{}
+	changes := Changes{}
+	for column, value := range values {
+		if field := s.LookUpField(column); field != nil {
+			column = field.DBName
+		}
+		if column == s.PrioritizedPrimaryField.DBName {
+			id = value
+		}
+		if !contains(t.config.IgnoredColumns, column) {
+			changes[column] = Change{New: value}
+		}
+	}
+	return id, changes
+}
+
+// loadOldRows keeps the rows an update or delete is about to change: the
+// one of the model when it has a primary key, otherwise the ones matching
+// the conditions of the statement.
+func (t *Trail) loadOldRows(db *gorm.DB) {
+	if !t.audited(db) || db.Statement.ReflectValue.Kind() != reflect.Struct {
+		return
+	}
+	var rows []map[string]interface{}
+	var err error
+	id, zero := db.Statement.Schema.PrioritizedPrimaryField.ValueOf(db.Statement.Context, db.Statement.ReflectValue)
+	if !zero {
+		var row map[string]interface{}
+		if row, err = t.load(db, id); err == nil {
+			rows = append(rows, row)
+		}
+	} else if where, ok := db.Statement.Clauses["WHERE"]; ok {
+		rows, err = t.loadWhere(db, where.Expression)
+	}
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			db.AddError(err)
+		}
+		return
+	}
+	if len(rows) > 0 {
+		db.InstanceSet(oldRowsKey, rows)
+	}
+}
+
+func (t *Trail) oldRows(db *gorm.DB) []map[string]interface{} {
+	old, ok := db.InstanceGet(oldRowsKey)
+	if !ok || db.Error != nil || db.RowsAffected == 0 {
+		return nil
+	}
+	return old.([]map[string]interface{})
+}
+
+func (t *Trail) afterUpdate(db *gorm.DB) {
+	pk := db.Statement.Schema.PrioritizedPrimaryField.DBName
+	for _, oldRow := range t.oldRows(db) {
+		id := oldRow[pk]
+		newRow, err := t.load(db, id)
+		if err != nil {
+			db.AddError(err)
+			return
+		}
+		changes := Changes{}
+		for column, value := range newRow {
+			if contains(t.config.IgnoredColumns, column) || reflect.DeepEqual(oldRow[column], value) {
+				continue
+			}
+			changes[column] = Change{Old: oldRow[column], New: value}
+		}
+		if len(changes) > 0 {
+			t.record(db, ActionUpdate, id, changes)
+		}
+	}
+}
+
+func (t *Trail) afterDelete(db *gorm.DB) {
+	pk := db.Statement.Schema.PrioritizedPrimaryField.DBName
+	for _, oldRow := range t.oldRows(db) {
+		changes := Changes{}
+		for column, value := range oldRow {
+			if !contains(t.config.IgnoredColumns, column) {
+				changes[column] = Change{Old: value}
+			}
+		}
+		t.record(db, ActionDelete, oldRow[pk], changes)
+	}
+}
+
+// session runs on the statement's connection, hence in its transaction.
+func (t *Trail) session(db *gorm.DB) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true})
+}
+
+func (t *Trail) load(db *gorm.DB, id interface{}) (map[string]interface{}, error) {
+	row := map[string]interface{}{}
+	err := t.session(db).Table(db.Statement.Table).
+		Where(clause.Eq{Column: clause.Column{Name: db.Statement.Schema.PrioritizedPrimaryField.DBName}, Value: id}).
+		Take(&row).Error
+	bytesToStrings(row)
+	return row, err
+}
+
+// loadWhere reads the rows matching where as the statement sees them, soft
+// deleted rows being left out unless it is unscoped, up to MaxWhereRows.
+func (t *Trail) loadWhere(db *gorm.DB, where clause.Expression) ([]map[string]interface{}, error) {
+	var rows []map[string]interface{}
+	q := t.session(db).Model(reflect.New(db.Statement.Schema.ModelType).Interface()).Clauses(where)
+	if db.Statement.Unscoped {
+		q = q.Unscoped()
+	}
+	if err := q.Limit(t.config.MaxWhereRows + 1).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) > t.config.MaxWhereRows {
+		return nil, fmt.Errorf("%w: more than %d in %s", ErrTooManyRows, t.config.MaxWhereRows, db.Statement.Table)
+	}
+	for _, row := range rows {
+		bytesToStrings(row)
+	}
+	return rows, nil
+}
+
+func bytesToStrings(row map[string]interface{}) {
+	for column, value := range row {
+		if b, ok := value.([]byte); ok {
+			row[column] = string(b)
+		}
+	}
+}
+
+func (t *Trail) record(db *gorm.DB, action string, id interface{}, changes Changes) {
+	record := &Record{
+		EntityType: db.Statement.Table,
+		EntityID:   fmt.Sprint(id),
+		Action:     action,
+		ActorID:    t.config.Actor(db.Statement.Context),
+		Changes:    changes,
+	}
+	if err := t.session(db).Table(t.config.Table).Create(record).Error; err != nil {
+		db.AddError(err)
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
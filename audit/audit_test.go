@@ -0,0 +1,180 @@
+package audit
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/best-expendables-v2/common-utils/model"
+	userclient "github.com/best-expendables-v2/user-service-client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type product struct {
+	model.BaseModel
+	Name string
+}
+
+// changesArg matches the JSON changes of a record.
+type changesArg Changes
+
+func (c changesArg) Match(v driver.Value) bool {
+	var changes Changes
+	if err := changes.Scan(v); err != nil {
+		return false
+	}
+	for column, change := range c {
+		if !reflect.DeepEqual(changes[column], change) {
+			return false
+		}
+	}
+	return true
+}
+
+func openMockDB(t *testing.T, trail *Trail) (*gorm.DB, sqlmock.Sqlmock) {
+	rawDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: rawDB}), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.Use(trail))
+	return db, mock
+}
+
+func insertRecord() string {
+	return regexp.QuoteMeta(`INSERT INTO "audit_records" ("id","created_at","updated_at","entity_type","entity_id","action","actor_id","changes")`)
+}
+
+func TestTrail_Create(t *testing.T) {
+	db, mock := openMockDB(t, New(WithIgnoredColumns("created_at", "updated_at")))
+	ctx := userclient.ContextWithUser(context.Background(), &userclient.User{Id: "u1"})
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "products"`)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertRecord()).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "products", "1", ActionCreate, "u1",
+			changesArg{"id": {New: "1"}, "name": {New: "book"}}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, db.WithContext(ctx).Create(&product{BaseModel: model.BaseModel{Id: "1"}, Name: "book"}).Error)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTrail_Update(t *testing.T) {
+	db, mock := openMockDB(t, New(WithActor(func(context.Context) string { return "u2" }), WithIgnoredColumns("updated_at")))
+	selectProduct := regexp.QuoteMeta(`SELECT * FROM "products" WHERE "id" = $1 LIMIT 1`)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(selectProduct).WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "updated_at"}).AddRow("1", "book", "yesterday"))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "products" SET`)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(selectProduct).WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "updated_at"}).AddRow("1", "pen", "today"))
+	mock.ExpectExec(insertRecord()).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "products", "1", ActionUpdate, "u2",
+			changesArg{"name": {Old: "book", New: "pen"}}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	p := &product{BaseModel: model.BaseModel{Id: "1"}}
+	assert.NoError(t, db.Model(p).Updates(map[string]interface{}{"name": "pen"}).Error)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTrail_DeleteRollsBackWithRecord(t *testing.T) {
+	db, mock := openMockDB(t, New())
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "products" WHERE "id" = $1 LIMIT 1`)).WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow("1", "book"))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "products" WHERE "products"."id" = $1`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertRecord()).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "products", "1", ActionDelete, "",
+			changesArg{"name": {Old: "book"}}).
+		WillReturnError(assert.AnError)
+	mock.ExpectRollback()
+
+	assert.Error(t, db.Delete(&product{BaseModel: model.BaseModel{Id: "1"}}).Error)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTrail_DeleteByConditions(t *testing.T) {
+	db, mock := openMockDB(t, New())
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "products" WHERE name = $1 LIMIT 1001`)).WithArgs("book").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow("1", "book").AddRow("2", "book"))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "products" WHERE name = $1`)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	for _, id := range []string{"1", "2"} {
+		mock.ExpectExec(insertRecord()).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "products", id, ActionDelete, "",
+				changesArg{"id": {Old: id}, "name": {Old: "book"}}).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+
+	assert.NoError(t, db.Where("name = ?", "book").Delete(&product{}).Error)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTrail_CreateFromMaps(t *testing.T) {
+	db, mock := openMockDB(t, New(WithActor(func(context.Context) string { return "u1" })))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "products" ("id","name") VALUES ($1,$2)`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(insertRecord()).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "products", "1", ActionCreate, "u1",
+			changesArg{"id": {New: "1"}, "name": {New: "book"}}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	assert.NoError(t, db.Model(&product{}).Create(map[string]interface{}{"Id": "1", "name": "book"}).Error)
+
+	// Without the primary key the row cannot be told, it is not audited.
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "products" ("name") VALUES ($1),($2)`)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	assert.NoError(t, db.Model(&product{}).Create([]map[string]interface{}{{"name": "pen"}, {"name": "ink"}}).Error)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTrail_DeleteByConditionsTooManyRows(t *testing.T) {
+	db, mock := openMockDB(t, New(WithMaxWhereRows(1)))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "products" WHERE name = $1 LIMIT 2`)).WithArgs("book").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow("1", "book").AddRow("2", "book"))
+	mock.ExpectRollback()
+
+	err := db.Where("name = ?", "book").Delete(&product{}).Error
+	assert.True(t, errors.Is(err, ErrTooManyRows))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTrail_History(t *testing.T) {
+	trail := New()
+	db, mock := openMockDB(t, trail)
+	changes, _ := json.Marshal(Changes{"name": {Old: "book", New: "pen"}})
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "audit_records" WHERE entity_type = $1 AND entity_id = $2 ORDER BY created_at`)).
+		WithArgs("products", "1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "action", "actor_id", "changes"}).AddRow("r1", ActionUpdate, "u1", changes))
+
+	records, err := trail.History(context.Background(), db, &product{BaseModel: model.BaseModel{Id: "1"}})
+	assert.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "u1", records[0].ActorID)
+	assert.Equal(t, Change{Old: "book", New: "pen"}, records[0].Changes["name"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
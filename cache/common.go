@@ -6,18 +6,19 @@ import (
 )
 
 var (
-	Nil = errors.New("cache: key is missing")
+	Nil       = errors.New("cache: key is missing")
+	NotStored = errors.New("cache: key was not stored")
 )
 
 type Cache interface {
-	Get(ctx context.Context, key string, obj interface{}) error
+	Get(ctx context.Context, key string, obj interface{}, opts ...Option) error
 	MGet(ctx context.Context, keys ...string) ([]interface{}, error)
-	Set(ctx context.Context, key string, obj interface{}) error
+	Set(ctx context.Context, key string, obj interface{}, opts ...Option) error
 	MSet(ctx context.Context, obj ...interface{}) error
 	HSet(ctx context.Context, key string, field string, obj interface{}) error
 	HGet(ctx context.Context, key string, field string) (string, error)
 	HGetAll(ctx context.Context, key string) (map[string]string, error)
 	Delete(ctx context.Context, key string) error
 	ScanD(ctx context.Context, match string) error
-	HExpire(ctx context.Context, key string) error
+	HExpire(ctx context.Context, key string, opts ...Option) error
 }
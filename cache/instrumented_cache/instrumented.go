@@ -0,0 +1,244 @@
+package instrumented_cache
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/best-expendables-v2/common-utils/cache"
+	"github.com/go-redis/redis/v8"
+	newrelic "github.com/newrelic/go-agent"
+)
+
+var _ cache.Cache = (*Instrumented)(nil)
+
+// Instrumented decorates a cache.Cache with hit/miss/error counters, latency
+// histograms and payload sizes per key prefix, and reports every call as a
+// New Relic datastore segment when a transaction is present in ctx.
+type Instrumented struct {
+	next       cache.Cache
+	metrics    Metrics
+	prefixFunc func(key string) string
+	product    newrelic.DatastoreProduct
+}
+
+type Option func(*Instrumented)
+
+// WithKeyPrefixFunc changes how keys are grouped in the metrics.
+func WithKeyPrefixFunc(fn func(key string) string) Option {
+	return func(i *Instrumented) {
+		i.prefixFunc = fn
+	}
+}
+
+// WithDatastoreProduct changes the product reported to New Relic, Redis by default.
+func WithDatastoreProduct(product newrelic.DatastoreProduct) Option {
+	return func(i *Instrumented) {
+		i.product = product
+	}
+}
+
+func NewInstrumented(next cache.Cache, metrics Metrics, opts ...Option) *Instrumented {
+	if metrics == nil {
+		metrics = noopMetrics{}
+	}
+	i := &Instrumented{
+		next:       next,
+		metrics:    metrics,
+		prefixFunc: KeyPrefix,
+		product:    newrelic.DatastoreRedis,
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i
+}
+
+// KeyPrefix returns the part of key before the first ":" or "/".
+func KeyPrefix(key string) string {
+	if i := strings.IndexAny(key, ":/"); i > -1 {
+		return key[:i]
+	}
+	return ""
+}
+
+func (i *Instrumented) Get(ctx context.Context, key string, obj interface{}, opts ...cache.Option) error {
+	prefix := i.prefixFunc(key)
+	err := i.observe(ctx, prefix, "GET", func() error {
+		return i.next.Get(ctx, key, obj, opts...)
+	})
+	if i.observeLookup(prefix, "GET", err) {
+		i.metrics.ObservePayloadSize(prefix, "GET", payloadSize(obj))
+	}
+	return err
+}
+
+func (i *Instrumented) MGet(ctx context.Context, keys ...string) ([]interface{}, error) {
+	var prefix string
+	if len(keys) > 0 {
+		prefix = i.prefixFunc(keys[0])
+	}
+	var result []interface{}
+	err := i.observe(ctx, prefix, "MGET", func() (err error) {
+		result, err = i.next.MGet(ctx, keys...)
+		return err
+	})
+	if i.observeLookup(prefix, "MGET", err) {
+		i.metrics.ObservePayloadSize(prefix, "MGET", payloadSize(result))
+	}
+	return result, err
+}
+
+func (i *Instrumented) Set(ctx context.Context, key string, obj interface{}, opts ...cache.Option) error {
+	prefix := i.prefixFunc(key)
+	i.metrics.ObservePayloadSize(prefix, "SET", payloadSize(obj))
+	err := i.observe(ctx, prefix, "SET", func() error {
+		return i.next.Set(ctx, key, obj, opts...)
+	})
+	i.observeWrite(prefix, "SET", err)
+	return err
+}
+
+func (i *Instrumented) MSet(ctx context.Context, obj ...interface{}) error {
+	var prefix string
+	if len(obj) > 0 {
+		if key, ok := obj[0].(string); ok {
+			prefix = i.prefixFunc(key)
+		}
+	}
+	i.metrics.ObservePayloadSize(prefix, "MSET", payloadSize(obj))
+	err := i.observe(ctx, prefix, "MSET", func() error {
+		return i.next.MSet(ctx, obj...)
+	})
+	i.observeWrite(prefix, "MSET", err)
+	return err
+}
+
+func (i *Instrumented) HSet(ctx context.Context, key string, field string, obj interface{}) error {
+	prefix := i.prefixFunc(key)
+	i.metrics.ObservePayloadSize(prefix, "HSET", payloadSize(obj))
+	err := i.observe(ctx, prefix, "HSET", func() error {
+		return i.next.HSet(ctx, key, field, obj)
+	})
+	i.observeWrite(prefix, "HSET", err)
+	return err
+}
+
+func (i *Instrumented) HGet(ctx context.Context, key string, field string) (string, error) {
+	prefix := i.prefixFunc(key)
+	var result string
+	err := i.observe(ctx, prefix, "HGET", func() (err error) {
+		result, err = i.next.HGet(ctx, key, field)
+		return err
+	})
+	if i.observeLookup(prefix, "HGET", err) {
+		i.metrics.ObservePayloadSize(prefix, "HGET", len(result))
+	}
+	return result, err
+}
+
+func (i *Instrumented) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	prefix := i.prefixFunc(key)
+	var result map[string]string
+	err := i.observe(ctx, prefix, "HGETALL", func() (err error) {
+		result, err = i.next.HGetAll(ctx, key)
+		return err
+	})
+	if err == nil && len(result) == 0 {
+		i.metrics.ObserveMiss(prefix, "HGETALL")
+	} else if i.observeLookup(prefix, "HGETALL", err) {
+		i.metrics.ObservePayloadSize(prefix, "HGETALL", payloadSize(result))
+	}
+	return result, err
+}
+
+func (i *Instrumented) Delete(ctx context.Context, key string) error {
+	prefix := i.prefixFunc(key)
+	err := i.observe(ctx, prefix, "DEL", func() error {
+		return i.next.Delete(ctx, key)
+	})
+	if err != nil && !isMiss(err) {
+		i.metrics.ObserveError(prefix, "DEL")
+	}
+	return err
+}
+
+func (i *Instrumented) ScanD(ctx context.Context, match string) error {
+	prefix := i.prefixFunc(match)
+	err := i.observe(ctx, prefix, "SCAN", func() error {
+		return i.next.ScanD(ctx, match)
+	})
+	i.observeWrite(prefix, "SCAN", err)
+	return err
+}
+
+func (i *Instrumented) HExpire(ctx context.Context, key string, opts ...cache.Option) error {
+	prefix := i.prefixFunc(key)
+	err := i.observe(ctx, prefix, "EXPIRE", func() error {
+		return i.next.HExpire(ctx, key, opts...)
+	})
+	i.observeWrite(prefix, "EXPIRE", err)
+	return err
+}
+
+// observe times fn and wraps it in a New Relic datastore segment.
+func (i *Instrumented) observe(ctx context.Context, prefix, operation string, fn func() error) error {
+	if txn := newrelic.FromContext(ctx); txn != nil {
+		segment := &newrelic.DatastoreSegment{
+			StartTime:  newrelic.StartSegmentNow(txn),
+			Product:    i.product,
+			Collection: prefix,
+			Operation:  operation,
+		}
+		defer segment.End()
+	}
+	start := time.Now()
+	err := fn()
+	i.metrics.ObserveLatency(prefix, operation, time.Since(start))
+	return err
+}
+
+// observeLookup records the outcome of a read and reports whether it was a hit.
+func (i *Instrumented) observeLookup(prefix, operation string, err error) bool {
+	switch {
+	case err == nil:
+		i.metrics.ObserveHit(prefix, operation)
+		return true
+	case isMiss(err):
+		i.metrics.ObserveMiss(prefix, operation)
+	default:
+		i.metrics.ObserveError(prefix, operation)
+	}
+	return false
+}
+
+func (i *Instrumented) observeWrite(prefix, operation string, err error) {
+	if err != nil && err != cache.NotStored {
+		i.metrics.ObserveError(prefix, operation)
+	}
+}
+
+func isMiss(err error) bool {
+	return err == cache.Nil || err == redis.Nil
+}
+
+func payloadSize(obj interface{}) int {
+	switch v := obj.(type) {
+	case nil:
+		return 0
+	case string:
+		return len(v)
+	case *string:
+		return len(*v)
+	case []byte:
+		return len(v)
+	case *[]byte:
+		return len(*v)
+	}
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return 0
+	}
+	return len(b)
+}
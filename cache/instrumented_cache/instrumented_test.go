@@ -0,0 +1,73 @@
+package instrumented_cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/best-expendables-v2/common-utils/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubCache struct {
+	cache.Cache
+	values map[string]string
+	err    error
+}
+
+func (s *stubCache) Get(ctx context.Context, key string, obj interface{}, opts ...cache.Option) error {
+	if s.err != nil {
+		return s.err
+	}
+	v, ok := s.values[key]
+	if !ok {
+		return cache.Nil
+	}
+	*obj.(*string) = v
+	return nil
+}
+
+func (s *stubCache) Set(ctx context.Context, key string, obj interface{}, opts ...cache.Option) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.values[key] = obj.(string)
+	return nil
+}
+
+func TestInstrumented(t *testing.T) {
+	ctx := context.Background()
+	stub := &stubCache{values: map[string]string{}}
+	stats := NewStats()
+	c := NewInstrumented(stub, stats)
+
+	var v string
+	assert.Equal(t, cache.Nil, c.Get(ctx, "order:1", &v))
+	assert.NoError(t, c.Set(ctx, "order:1", "hello"))
+	assert.NoError(t, c.Get(ctx, "order:1", &v))
+	assert.NoError(t, c.Get(ctx, "order:1", &v))
+	assert.Equal(t, cache.Nil, c.Get(ctx, "user/1", &v))
+
+	stub.err = errors.New("connection refused")
+	assert.Error(t, c.Get(ctx, "order:2", &v))
+
+	snapshot := stats.Snapshot()
+	assert.Len(t, snapshot, 3)
+
+	get := snapshot[0]
+	assert.Equal(t, "order", get.Prefix)
+	assert.Equal(t, "GET", get.Operation)
+	assert.Equal(t, int64(2), get.Hits)
+	assert.Equal(t, int64(1), get.Misses)
+	assert.Equal(t, int64(1), get.Errors)
+	assert.Equal(t, int64(4), get.Latency.Count)
+	assert.Equal(t, int64(10), get.PayloadBytes)
+	assert.InDelta(t, 2.0/3.0, get.HitRatio(), 0.001)
+
+	set := snapshot[1]
+	assert.Equal(t, "SET", set.Operation)
+	assert.Equal(t, int64(5), set.PayloadBytes)
+
+	assert.Equal(t, "user", snapshot[2].Prefix)
+	assert.Equal(t, int64(1), snapshot[2].Misses)
+}
@@ -0,0 +1,160 @@
+package instrumented_cache
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+var DefaultLatencyBuckets = []time.Duration{
+	500 * time.Microsecond,
+	time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	time.Second,
+}
+
+// Metrics receives the measurements of an Instrumented cache. Implementations
+// must be safe for concurrent use.
+type Metrics interface {
+	ObserveHit(prefix, operation string)
+	ObserveMiss(prefix, operation string)
+	ObserveError(prefix, operation string)
+	ObserveLatency(prefix, operation string, d time.Duration)
+	ObservePayloadSize(prefix, operation string, size int)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveHit(string, string)                    {}
+func (noopMetrics) ObserveMiss(string, string)                   {}
+func (noopMetrics) ObserveError(string, string)                  {}
+func (noopMetrics) ObserveLatency(string, string, time.Duration) {}
+func (noopMetrics) ObservePayloadSize(string, string, int)       {}
+
+type Histogram struct {
+	Buckets []time.Duration `json:"buckets"`
+	// Counts has one entry per bucket plus a trailing overflow entry.
+	Counts []int64       `json:"counts"`
+	Count  int64         `json:"count"`
+	Sum    time.Duration `json:"sum"`
+}
+
+func newHistogram(buckets []time.Duration) Histogram {
+	return Histogram{
+		Buckets: buckets,
+		Counts:  make([]int64, len(buckets)+1),
+	}
+}
+
+func (h *Histogram) observe(d time.Duration) {
+	i := sort.Search(len(h.Buckets), func(i int) bool { return d <= h.Buckets[i] })
+	h.Counts[i]++
+	h.Count++
+	h.Sum += d
+}
+
+type Series struct {
+	Prefix       string    `json:"prefix"`
+	Operation    string    `json:"operation"`
+	Hits         int64     `json:"hits"`
+	Misses       int64     `json:"misses"`
+	Errors       int64     `json:"errors"`
+	Latency      Histogram `json:"latency"`
+	PayloadBytes int64     `json:"payloadBytes"`
+	Payloads     int64     `json:"payloads"`
+}
+
+// HitRatio returns hits / (hits + misses), or 0 without any lookup.
+func (s Series) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+type seriesKey struct {
+	prefix    string
+	operation string
+}
+
+// Stats is an in-memory Metrics implementation, useful when no metrics
+// backend is wired or for exposing the numbers on a debug endpoint.
+type Stats struct {
+	mu      sync.Mutex
+	buckets []time.Duration
+	series  map[seriesKey]*Series
+}
+
+func NewStats(buckets ...time.Duration) *Stats {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	return &Stats{
+		buckets: buckets,
+		series:  map[seriesKey]*Series{},
+	}
+}
+
+func (s *Stats) ObserveHit(prefix, operation string) {
+	s.update(prefix, operation, func(series *Series) { series.Hits++ })
+}
+
+func (s *Stats) ObserveMiss(prefix, operation string) {
+	s.update(prefix, operation, func(series *Series) { series.Misses++ })
+}
+
+func (s *Stats) ObserveError(prefix, operation string) {
+	s.update(prefix, operation, func(series *Series) { series.Errors++ })
+}
+
+func (s *Stats) ObserveLatency(prefix, operation string, d time.Duration) {
+	s.update(prefix, operation, func(series *Series) { series.Latency.observe(d) })
+}
+
+func (s *Stats) ObservePayloadSize(prefix, operation string, size int) {
+	s.update(prefix, operation, func(series *Series) {
+		series.PayloadBytes += int64(size)
+		series.Payloads++
+	})
+}
+
+// Snapshot returns a copy of every series sorted by prefix and operation.
+func (s *Stats) Snapshot() []Series {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]Series, 0, len(s.series))
+	for _, series := range s.series {
+		c := *series
+		c.Latency.Counts = append([]int64(nil), series.Latency.Counts...)
+		result = append(result, c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Prefix != result[j].Prefix {
+			return result[i].Prefix < result[j].Prefix
+		}
+		return result[i].Operation < result[j].Operation
+	})
+	return result
+}
+
+func (s *Stats) update(prefix, operation string, fn func(series *Series)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := seriesKey{prefix: prefix, operation: operation}
+	series, ok := s.series[key]
+	if !ok {
+		series = &Series{
+			Prefix:    prefix,
+			Operation: operation,
+			Latency:   newHistogram(s.buckets),
+		}
+		s.series[key] = series
+	}
+	fn(series)
+}
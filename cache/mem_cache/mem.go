@@ -1,6 +1,7 @@
 package mem_cache
 
 import (
+	"context"
 	commonCache "github.com/best-expendables-v2/common-utils/cache"
 	"github.com/patrickmn/go-cache"
 	"reflect"
@@ -8,32 +9,88 @@ import (
 )
 
 type Mem struct {
-	c *cache.Cache
+	c   *cache.Cache
+	ttl time.Duration
 }
 
 func NewMem(ttl time.Duration) *Mem {
-	return &Mem{cache.New(ttl, 10*time.Minute)}
+	return &Mem{c: cache.New(ttl, 10*time.Minute), ttl: ttl}
 }
 
-func (m *Mem) Get(key string, obj interface{}) error {
+func (m *Mem) Get(key string, obj interface{}, opts ...commonCache.Option) error {
 	value, found := m.c.Get(key)
-	if found {
-		v := reflect.ValueOf(obj).Elem()
-		rv := reflect.ValueOf(value)
-		if rv.Kind() == reflect.Ptr {
-			rv = rv.Elem()
+	if !found {
+		return commonCache.Nil
+	}
+	v := reflect.ValueOf(obj).Elem()
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	v.Set(rv)
+
+	o := commonCache.NewOptions(m.ttl, opts...)
+	if o.StaleWhileRevalidate > 0 {
+		m.revalidate(key, o)
+	}
+	if o.SlidingExpiration {
+		m.c.Set(key, value, o.TTL+o.StaleWhileRevalidate)
+		if _, fresh := m.c.Get(commonCache.FreshKey(key)); fresh {
+			m.c.Set(commonCache.FreshKey(key), true, o.TTL)
 		}
-		v.Set(rv)
-		return nil
 	}
-	return commonCache.Nil
+	return nil
 }
 
-func (m *Mem) Set(key string, obj interface{}) error {
-	m.c.Set(key, obj, cache.DefaultExpiration)
+func (m *Mem) Set(key string, obj interface{}, opts ...commonCache.Option) error {
+	return m.set(key, obj, commonCache.NewOptions(m.ttl, opts...))
+}
+
+func (m *Mem) set(key string, obj interface{}, o commonCache.Options) error {
+	ttl := o.TTL + o.StaleWhileRevalidate
+	switch {
+	case o.SetNX:
+		if err := m.c.Add(key, obj, ttl); err != nil {
+			return commonCache.NotStored
+		}
+	case o.SetXX:
+		if err := m.c.Replace(key, obj, ttl); err != nil {
+			return commonCache.NotStored
+		}
+	default:
+		m.c.Set(key, obj, ttl)
+	}
+
+	if o.StaleWhileRevalidate > 0 {
+		m.c.Set(commonCache.FreshKey(key), true, o.TTL)
+	}
 	return nil
 }
 
+// revalidate refreshes key in the background once its fresh marker expired.
+func (m *Mem) revalidate(key string, o commonCache.Options) {
+	if o.Refresher == nil {
+		return
+	}
+	if _, fresh := m.c.Get(commonCache.FreshKey(key)); fresh {
+		return
+	}
+	lockKey := commonCache.RevalidateLockKey(key)
+	if err := m.c.Add(lockKey, true, o.StaleWhileRevalidate); err != nil {
+		return
+	}
+
+	o.SetNX, o.SetXX = false, false
+	go func() {
+		defer m.c.Delete(lockKey)
+		obj, err := o.Refresher(context.Background(), key)
+		if err != nil {
+			return
+		}
+		_ = m.set(key, obj, o)
+	}()
+}
+
 func (m *Mem) Delete(key string) error {
 	m.c.Delete(key)
 	return nil
@@ -0,0 +1,64 @@
+package mem_cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	commonCache "github.com/best-expendables-v2/common-utils/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMem_SetWithTTL(t *testing.T) {
+	m := NewMem(time.Hour)
+	assert.NoError(t, m.Set("key", "value", commonCache.WithTTL(20*time.Millisecond)))
+
+	var v string
+	assert.NoError(t, m.Get("key", &v))
+	assert.Equal(t, "value", v)
+
+	time.Sleep(40 * time.Millisecond)
+	assert.Equal(t, commonCache.Nil, m.Get("key", &v))
+}
+
+func TestMem_SetNXAndSetXX(t *testing.T) {
+	m := NewMem(time.Hour)
+	assert.Equal(t, commonCache.NotStored, m.Set("key", "first", commonCache.WithSetXX()))
+	assert.NoError(t, m.Set("key", "first", commonCache.WithSetNX()))
+	assert.Equal(t, commonCache.NotStored, m.Set("key", "second", commonCache.WithSetNX()))
+	assert.NoError(t, m.Set("key", "third", commonCache.WithSetXX()))
+
+	var v string
+	assert.NoError(t, m.Get("key", &v))
+	assert.Equal(t, "third", v)
+}
+
+func TestMem_SlidingExpiration(t *testing.T) {
+	m := NewMem(50 * time.Millisecond)
+	assert.NoError(t, m.Set("key", "value"))
+
+	var v string
+	for i := 0; i < 4; i++ {
+		time.Sleep(30 * time.Millisecond)
+		assert.NoError(t, m.Get("key", &v, commonCache.WithSlidingExpiration()))
+	}
+	time.Sleep(80 * time.Millisecond)
+	assert.Equal(t, commonCache.Nil, m.Get("key", &v))
+}
+
+func TestMem_StaleWhileRevalidate(t *testing.T) {
+	m := NewMem(20 * time.Millisecond)
+	swr := commonCache.WithStaleWhileRevalidate(time.Second, func(ctx context.Context, key string) (interface{}, error) {
+		return "new", nil
+	})
+	assert.NoError(t, m.Set("key", "old", swr))
+
+	time.Sleep(40 * time.Millisecond)
+	var v string
+	assert.NoError(t, m.Get("key", &v, swr))
+	assert.Equal(t, "old", v)
+
+	assert.Eventually(t, func() bool {
+		return m.Get("key", &v, swr) == nil && v == "new"
+	}, time.Second, 5*time.Millisecond)
+}
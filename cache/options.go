@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Refresher reloads the value of key when a stale entry is served.
+type Refresher func(ctx context.Context, key string) (interface{}, error)
+
+type Options struct {
+	TTL                  time.Duration
+	SlidingExpiration    bool
+	StaleWhileRevalidate time.Duration
+	Refresher            Refresher
+	SetNX                bool
+	SetXX                bool
+}
+
+type Option func(*Options)
+
+// WithTTL overrides the backend's default expiration for a single call.
+func WithTTL(ttl time.Duration) Option {
+	return func(o *Options) {
+		o.TTL = ttl
+	}
+}
+
+// WithSlidingExpiration resets the expiration of a key every time it is read.
+func WithSlidingExpiration() Option {
+	return func(o *Options) {
+		o.SlidingExpiration = true
+	}
+}
+
+// WithStaleWhileRevalidate keeps an entry for an extra d after it expires.
+// Reads in that window return the stale value and refresh it in the
+// background through refresher.
+func WithStaleWhileRevalidate(d time.Duration, refresher Refresher) Option {
+	return func(o *Options) {
+		o.StaleWhileRevalidate = d
+		o.Refresher = refresher
+	}
+}
+
+// WithSetNX only stores the value if the key does not exist yet.
+func WithSetNX() Option {
+	return func(o *Options) {
+		o.SetNX = true
+	}
+}
+
+// WithSetXX only stores the value if the key already exists.
+func WithSetXX() Option {
+	return func(o *Options) {
+		o.SetXX = true
+	}
+}
+
+// NewOptions applies opts on top of the default ttl of a backend.
+func NewOptions(ttl time.Duration, opts ...Option) Options {
+	o := Options{TTL: ttl}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// FreshKey is the companion key whose presence marks key as fresh when
+// stale-while-revalidate is used.
+func FreshKey(key string) string {
+	return key + ":fresh"
+}
+
+// RevalidateLockKey guards against concurrent background refreshes of key.
+func RevalidateLockKey(key string) string {
+	return key + ":revalidate"
+}
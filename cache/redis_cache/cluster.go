@@ -0,0 +1,99 @@
+package redis_cache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const clusterSlots = 16384
+
+// forEachMaster calls fn once per master shard when running against
+// Redis Cluster, or once with the client itself otherwise.
+func forEachMaster(ctx context.Context, c redis.UniversalClient, fn func(ctx context.Context, client redis.UniversalClient) error) error {
+	if cluster, ok := c.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			return fn(ctx, client)
+		})
+	}
+	return fn(ctx, c)
+}
+
+func isCluster(c redis.UniversalClient) bool {
+	_, ok := c.(*redis.ClusterClient)
+	return ok
+}
+
+// groupKeysBySlot returns the indexes of keys grouped by their cluster hash
+// slot, keeping the slots in order of first appearance.
+func groupKeysBySlot(keys []string) [][]int {
+	var groups [][]int
+	slotGroup := make(map[int]int)
+	for i, key := range keys {
+		slot := keySlot(key)
+		g, ok := slotGroup[slot]
+		if !ok {
+			g = len(groups)
+			slotGroup[slot] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+	return groups
+}
+
+// flattenPairs normalises the arguments accepted by MSET into a flat
+// key/value list.
+func flattenPairs(values ...interface{}) ([]interface{}, error) {
+	var pairs []interface{}
+	if len(values) == 1 {
+		switch arg := values[0].(type) {
+		case []string:
+			for _, s := range arg {
+				pairs = append(pairs, s)
+			}
+		case []interface{}:
+			pairs = append(pairs, arg...)
+		case map[string]interface{}:
+			for k, v := range arg {
+				pairs = append(pairs, k, v)
+			}
+		default:
+			pairs = append(pairs, arg)
+		}
+	} else {
+		pairs = append(pairs, values...)
+	}
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("redis_cache: odd number of arguments for MSET: %d", len(pairs))
+	}
+	return pairs, nil
+}
+
+// keySlot computes the Redis Cluster hash slot of key, honouring hash tags.
+func keySlot(key string) int {
+	if s := strings.IndexByte(key, '{'); s > -1 {
+		if e := strings.IndexByte(key[s+1:], '}'); e > 0 {
+			key = key[s+1 : s+e+1]
+		}
+	}
+	return int(crc16(key) % clusterSlots)
+}
+
+// crc16 implements CRC16-CCITT (XMODEM) as used by Redis Cluster.
+func crc16(key string) uint16 {
+	var crc uint16
+	for i := 0; i < len(key); i++ {
+		crc ^= uint16(key[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
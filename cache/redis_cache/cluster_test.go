@@ -0,0 +1,35 @@
+package redis_cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_keySlot(t *testing.T) {
+	assert.Equal(t, 12739, keySlot("123456789"))
+	assert.Equal(t, 12182, keySlot("foo"))
+	assert.Equal(t, keySlot("{user1000}.following"), keySlot("{user1000}.followers"))
+	assert.Equal(t, keySlot("user1000"), keySlot("{user1000}.following"))
+	// Empty hash tags hash the whole key.
+	assert.Equal(t, int(crc16("foo{}{bar}")%clusterSlots), keySlot("foo{}{bar}"))
+	assert.Equal(t, keySlot("{bar"), keySlot("foo{{bar}}zap"))
+}
+
+func Test_groupKeysBySlot(t *testing.T) {
+	keys := []string{"{a}1", "{b}1", "{a}2", "{b}2", "{c}1"}
+	assert.Equal(t, [][]int{{0, 2}, {1, 3}, {4}}, groupKeysBySlot(keys))
+}
+
+func Test_flattenPairs(t *testing.T) {
+	pairs, err := flattenPairs("k1", 1, "k2", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"k1", 1, "k2", 2}, pairs)
+
+	pairs, err = flattenPairs([]interface{}{"k1", 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"k1", 1}, pairs)
+
+	_, err = flattenPairs("k1", 1, "k2")
+	assert.Error(t, err)
+}
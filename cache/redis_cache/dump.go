@@ -0,0 +1,174 @@
+package redis_cache
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	dumpTypeString = "string"
+	dumpTypeHash   = "hash"
+)
+
+// DumpEntry is one line of an export file. Keys are stored without the cache
+// prefix so a dump can be restored under another prefix.
+type DumpEntry struct {
+	Key   string            `json:"key"`
+	Type  string            `json:"type"`
+	Value []byte            `json:"value,omitempty"`
+	Hash  map[string]string `json:"hash,omitempty"`
+	// TTLMs is the remaining time to live in milliseconds, 0 when the key never expires.
+	TTLMs int64 `json:"ttlMs,omitempty"`
+}
+
+// Export writes every string and hash key of the prefix matching match (all
+// keys when empty) as JSON lines, and returns the number of keys written.
+func (r *Redis) Export(ctx context.Context, w io.Writer, match string) (int, error) {
+	if match == "" {
+		match = "*"
+	}
+	var (
+		mu    sync.Mutex
+		count int
+	)
+	enc := json.NewEncoder(w)
+	err := forEachMaster(ctx, r.Client, func(ctx context.Context, client redis.UniversalClient) error {
+		scan := client.Scan(ctx, 0, r.cacheKey(match), 0).Iterator()
+		for scan.Next(ctx) {
+			entry, ok, err := r.dumpKey(ctx, client, scan.Val())
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			mu.Lock()
+			err = enc.Encode(entry)
+			count++
+			mu.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+		return scan.Err()
+	})
+	return count, err
+}
+
+// ExportFile is Export into the file at path.
+func (r *Redis) ExportFile(ctx context.Context, path string, match string) (int, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	w := bufio.NewWriter(f)
+	count, err := r.Export(ctx, w, match)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return count, err
+}
+
+// Import restores the entries written by Export under the prefix of r and
+// returns the number of keys restored.
+func (r *Redis) Import(ctx context.Context, rd io.Reader) (int, error) {
+	dec := json.NewDecoder(rd)
+	count := 0
+	for {
+		var entry DumpEntry
+		err := dec.Decode(&entry)
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		if err := r.restoreKey(ctx, entry); err != nil {
+			return count, err
+		}
+		count++
+	}
+}
+
+// ImportFile is Import from the file at path.
+func (r *Redis) ImportFile(ctx context.Context, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return r.Import(ctx, bufio.NewReader(f))
+}
+
+func (r *Redis) dumpKey(ctx context.Context, client redis.UniversalClient, key string) (DumpEntry, bool, error) {
+	entry := DumpEntry{Key: strings.TrimPrefix(key, r.cacheKey(""))}
+	keyType, err := client.Type(ctx, key).Result()
+	if err != nil {
+		return entry, false, err
+	}
+	switch keyType {
+	case dumpTypeString:
+		entry.Value, err = client.Get(ctx, key).Bytes()
+	case dumpTypeHash:
+		entry.Hash, err = client.HGetAll(ctx, key).Result()
+	default:
+		// Expired in the meantime ("none") or not written by this package.
+		return entry, false, nil
+	}
+	if err == redis.Nil {
+		return entry, false, nil
+	}
+	if err != nil {
+		return entry, false, err
+	}
+	entry.Type = keyType
+
+	ttl, err := client.PTTL(ctx, key).Result()
+	if err != nil {
+		return entry, false, err
+	}
+	if ttl > 0 {
+		entry.TTLMs = ttl.Milliseconds()
+	}
+	return entry, true, nil
+}
+
+func (r *Redis) restoreKey(ctx context.Context, entry DumpEntry) error {
+	key := r.cacheKey(entry.Key)
+	ttl := time.Duration(entry.TTLMs) * time.Millisecond
+	switch entry.Type {
+	case dumpTypeString:
+		return r.Client.Set(ctx, key, entry.Value, ttl).Err()
+	case dumpTypeHash:
+		if len(entry.Hash) == 0 {
+			return nil
+		}
+		fields := make(map[string]interface{}, len(entry.Hash))
+		for field, value := range entry.Hash {
+			fields[field] = value
+		}
+		// HSET merges into an existing hash and keeps its expiry, the key is
+		// replaced instead.
+		pipe := r.Client.TxPipeline()
+		pipe.Del(ctx, key)
+		pipe.HSet(ctx, key, fields)
+		if ttl > 0 {
+			pipe.PExpire(ctx, key, ttl)
+		}
+		_, err := pipe.Exec(ctx)
+		return err
+	}
+	return fmt.Errorf("redis_cache: unsupported dump entry type %q for key %q", entry.Type, entry.Key)
+}
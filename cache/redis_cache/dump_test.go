@@ -0,0 +1,47 @@
+package redis_cache
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedis_ExportImport(t *testing.T) {
+	ctx := context.Background()
+	src, srcServer := newTestRedis(t, "products")
+	require.NoError(t, src.Set(ctx, "1", "book"))
+	require.NoError(t, src.HSet(ctx, "stock", "warehouse", "3"))
+	srcServer.SetTTL(src.cacheKey("stock"), 10*time.Minute)
+	require.NoError(t, src.Client.Set(ctx, src.cacheKey("forever"), "raw", 0).Err())
+
+	var dump bytes.Buffer
+	count, err := src.Export(ctx, &dump, "")
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	dst, dstServer := newTestRedis(t, "restored")
+	require.NoError(t, dst.HSet(ctx, "stock", "stale", "1"))
+	require.NoError(t, dst.Client.Set(ctx, dst.cacheKey("forever"), "old", time.Minute).Err())
+	count, err = dst.Import(ctx, &dump)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	var value string
+	require.NoError(t, dst.Get(ctx, "1", &value))
+	assert.Equal(t, "book", value)
+	assert.Equal(t, time.Hour, dstServer.TTL(dst.cacheKey("1")))
+
+	stock, err := dst.HGetAll(ctx, "stock")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"warehouse": "3"}, stock)
+	assert.Equal(t, 10*time.Minute, dstServer.TTL(dst.cacheKey("stock")))
+
+	raw, err := dst.Client.Get(ctx, dst.cacheKey("forever")).Result()
+	require.NoError(t, err)
+	assert.Equal(t, "raw", raw)
+	assert.Equal(t, time.Duration(0), dstServer.TTL(dst.cacheKey("forever")))
+}
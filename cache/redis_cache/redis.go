@@ -2,6 +2,7 @@ package redis_cache
 
 import (
 	"context"
+	"fmt"
 	"github.com/best-expendables-v2/common-utils/cache"
 	"time"
 
@@ -10,13 +11,13 @@ import (
 )
 
 type Redis struct {
-	Client *redis.Client
+	Client redis.UniversalClient
 	Cache  *redisCache.Cache
 	Prefix string
 	Ttl    time.Duration
 }
 
-func NewRedis(c *redis.Client, prefix string, ttl time.Duration) *Redis {
+func NewRedis(c redis.UniversalClient, prefix string, ttl time.Duration) *Redis {
 	return &Redis{
 		Client: c,
 		Cache:  NewRedisCache(c),
@@ -25,8 +26,8 @@ func NewRedis(c *redis.Client, prefix string, ttl time.Duration) *Redis {
 	}
 }
 
-func NewRedisCacheCreateFunc(prefix string, ttl time.Duration) func(c *redis.Client) *Redis {
-	return func(c *redis.Client) *Redis {
+func NewRedisCacheCreateFunc(prefix string, ttl time.Duration) func(c redis.UniversalClient) *Redis {
+	return func(c redis.UniversalClient) *Redis {
 		return &Redis{
 			Client: c,
 			Cache:  NewRedisCache(c),
@@ -36,16 +37,29 @@ func NewRedisCacheCreateFunc(prefix string, ttl time.Duration) func(c *redis.Cli
 	}
 }
 
-func (r *Redis) Get(ctx context.Context, key string, obj interface{}) error {
+func (r *Redis) Get(ctx context.Context, key string, obj interface{}, opts ...cache.Option) error {
 	err := r.Cache.Get(ctx, r.cacheKey(key), obj)
 	if err == redisCache.ErrCacheMiss {
 		return cache.Nil
 	}
-	return err
+	if err != nil {
+		return err
+	}
+
+	o := cache.NewOptions(r.Ttl, opts...)
+	if o.StaleWhileRevalidate > 0 {
+		if err := r.revalidate(ctx, key, o); err != nil {
+			return err
+		}
+	}
+	if o.SlidingExpiration {
+		return r.touch(ctx, key, o)
+	}
+	return nil
 }
 
 func (r *Redis) MGet(ctx context.Context, keys ...string) ([]interface{}, error) {
-	result, err := r.Client.MGet(ctx, r.cacheKeys(keys...)...).Result()
+	result, err := r.mget(ctx, r.cacheKeys(keys...))
 	for i := range result {
 		if result[i] == nil {
 			return nil, cache.Nil
@@ -57,13 +71,131 @@ func (r *Redis) MGet(ctx context.Context, keys ...string) ([]interface{}, error)
 	return result, nil
 }
 
-func (r *Redis) Set(ctx context.Context, key string, obj interface{}) error {
-	return r.Cache.Set(&redisCache.Item{
-		Ctx:   ctx,
-		Key:   r.cacheKey(key),
-		Value: obj,
-		TTL:   r.Ttl,
-	})
+// mget splits the lookup per hash slot in cluster mode, since a single MGET
+// cannot span slots there.
+func (r *Redis) mget(ctx context.Context, keys []string) ([]interface{}, error) {
+	if !isCluster(r.Client) {
+		return r.Client.MGet(ctx, keys...).Result()
+	}
+	result := make([]interface{}, len(keys))
+	for _, group := range groupKeysBySlot(keys) {
+		slotKeys := make([]string, len(group))
+		for i, idx := range group {
+			slotKeys[i] = keys[idx]
+		}
+		values, err := r.Client.MGet(ctx, slotKeys...).Result()
+		if err != nil {
+			return nil, err
+		}
+		for i, idx := range group {
+			result[idx] = values[i]
+		}
+	}
+	return result, nil
+}
+
+func (r *Redis) Set(ctx context.Context, key string, obj interface{}, opts ...cache.Option) error {
+	return r.set(ctx, key, obj, cache.NewOptions(r.Ttl, opts...))
+}
+
+func (r *Redis) set(ctx context.Context, key string, obj interface{}, o cache.Options) error {
+	ttl := o.TTL + o.StaleWhileRevalidate
+	if o.SetNX || o.SetXX {
+		b, err := r.Cache.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		var stored bool
+		if o.SetNX {
+			stored, err = r.Client.SetNX(ctx, r.cacheKey(key), b, itemTTL(ttl)).Result()
+		} else {
+			stored, err = r.Client.SetXX(ctx, r.cacheKey(key), b, itemTTL(ttl)).Result()
+		}
+		if err != nil {
+			return err
+		}
+		if !stored {
+			return cache.NotStored
+		}
+	} else {
+		err := r.Cache.Set(&redisCache.Item{
+			Ctx:   ctx,
+			Key:   r.cacheKey(key),
+			Value: obj,
+			TTL:   ttl,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if o.StaleWhileRevalidate > 0 {
+		return r.Client.Set(ctx, cache.FreshKey(r.cacheKey(key)), 1, o.TTL).Err()
+	}
+	return nil
+}
+
+// itemTTL is the expiration redisCache.Cache.Set gives an item with the
+// given TTL: none when negative and an hour when shorter than a second.
+func itemTTL(ttl time.Duration) time.Duration {
+	if ttl < 0 {
+		return 0
+	}
+	if ttl != 0 && ttl < time.Second {
+		return time.Hour
+	}
+	return ttl
+}
+
+// revalidate refreshes key in the background once its fresh marker is gone.
+// Only one caller wins the refresh lock, the others keep serving the stale value.
+func (r *Redis) revalidate(ctx context.Context, key string, o cache.Options) error {
+	if o.Refresher == nil {
+		return nil
+	}
+	freshKey := cache.FreshKey(r.cacheKey(key))
+	fresh, err := r.Client.Exists(ctx, freshKey).Result()
+	if err != nil || fresh > 0 {
+		return err
+	}
+	// The marker cannot be written atomically with the value, they may be in
+	// different cluster slots. A value still in its fresh period only lost
+	// its marker, which is restored instead of refreshing.
+	ttl, err := r.Client.PTTL(ctx, r.cacheKey(key)).Result()
+	if err != nil {
+		return err
+	}
+	if remaining := ttl - o.StaleWhileRevalidate; remaining > 0 {
+		return r.Client.Set(ctx, freshKey, 1, remaining).Err()
+	}
+	lockKey := cache.RevalidateLockKey(r.cacheKey(key))
+	locked, err := r.Client.SetNX(ctx, lockKey, 1, o.StaleWhileRevalidate).Result()
+	if err != nil || !locked {
+		return err
+	}
+
+	o.SetNX, o.SetXX = false, false
+	go func() {
+		ctx := context.Background()
+		defer r.Client.Del(ctx, lockKey)
+		obj, err := o.Refresher(ctx, key)
+		if err != nil {
+			return
+		}
+		_ = r.set(ctx, key, obj, o)
+	}()
+	return nil
+}
+
+// touch pushes back the expiration of key for sliding expiration.
+func (r *Redis) touch(ctx context.Context, key string, o cache.Options) error {
+	if err := r.Client.Expire(ctx, r.cacheKey(key), o.TTL+o.StaleWhileRevalidate).Err(); err != nil {
+		return err
+	}
+	if o.StaleWhileRevalidate > 0 {
+		return r.Client.Expire(ctx, cache.FreshKey(r.cacheKey(key)), o.TTL).Err()
+	}
+	return nil
 }
 
 func (r *Redis) HSet(ctx context.Context, key string, field string, obj interface{}) error {
@@ -91,7 +223,27 @@ func (r *Redis) HGetAll(ctx context.Context, key string) (map[string]string, err
 }
 
 func (r *Redis) MSet(ctx context.Context, obj ...interface{}) error {
-	return r.Client.MSet(ctx, obj...).Err()
+	if !isCluster(r.Client) {
+		return r.Client.MSet(ctx, obj...).Err()
+	}
+	pairs, err := flattenPairs(obj...)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		keys = append(keys, fmt.Sprint(pairs[i]))
+	}
+	for _, group := range groupKeysBySlot(keys) {
+		slotPairs := make([]interface{}, 0, 2*len(group))
+		for _, idx := range group {
+			slotPairs = append(slotPairs, keys[idx], pairs[2*idx+1])
+		}
+		if err := r.Client.MSet(ctx, slotPairs...).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (r *Redis) Delete(ctx context.Context, key string) error {
@@ -103,22 +255,29 @@ func (r *Redis) Delete(ctx context.Context, key string) error {
 }
 
 func (r *Redis) ScanD(ctx context.Context, match string) error {
-	scan := r.Client.Scan(ctx, 0, r.cacheKey(match), 0).Iterator()
-	for scan.Next(ctx) {
-		err := r.Client.Del(ctx, scan.Val()).Err()
-		if err != nil {
-			return err
+	return forEachMaster(ctx, r.Client, func(ctx context.Context, client redis.UniversalClient) error {
+		scan := client.Scan(ctx, 0, r.cacheKey(match), 0).Iterator()
+		for scan.Next(ctx) {
+			err := client.Del(ctx, scan.Val()).Err()
+			if err != nil {
+				return err
+			}
 		}
-	}
-
-	return nil
+		return scan.Err()
+	})
 }
 
-func (r *Redis) HExpire(ctx context.Context, key string) error {
-	_, err := r.Client.Expire(ctx, r.cacheKey(key), r.Ttl).Result()
+func (r *Redis) HExpire(ctx context.Context, key string, opts ...cache.Option) error {
+	o := cache.NewOptions(r.Ttl, opts...)
+	_, err := r.Client.Expire(ctx, r.cacheKey(key), o.TTL).Result()
 	return err
 }
 
+// Stats returns the hit and miss counters of Get since the cache was created.
+func (r *Redis) Stats() *redisCache.Stats {
+	return r.Cache.Stats()
+}
+
 func (r *Redis) cacheKey(key string) string {
 	return r.Prefix + "/" + key
 }
@@ -5,10 +5,10 @@ import (
 	"github.com/go-redis/redis/v8"
 )
 
-func NewRedisCache(redis *redis.Client) *redisCache.Cache {
+func NewRedisCache(redis redis.UniversalClient) *redisCache.Cache {
 	return redisCache.New(&redisCache.Options{
 		Redis:         redis,
-		StatsEnabled:  false,
+		StatsEnabled:  true,
 		LocalCache:    nil,
 		LocalCacheTTL: 0,
 	})
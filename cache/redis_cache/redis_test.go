@@ -0,0 +1,96 @@
+package redis_cache
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/best-expendables-v2/common-utils/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedis_SetNXAndXXExpireLikeSet(t *testing.T) {
+	r, mr := newTestRedis(t, "app")
+	ctx := context.Background()
+
+	for _, ttl := range []time.Duration{0, 500 * time.Millisecond, time.Minute} {
+		require.NoError(t, r.Set(ctx, "plain", "v", cache.WithTTL(ttl)))
+		require.NoError(t, r.Set(ctx, "nx", "v", cache.WithTTL(ttl), cache.WithSetNX()))
+		require.NoError(t, r.Set(ctx, "nx", "v", cache.WithTTL(ttl), cache.WithSetXX()))
+		assert.Equal(t, mr.TTL(r.cacheKey("plain")), mr.TTL(r.cacheKey("nx")), "ttl %s", ttl)
+		mr.FlushAll()
+	}
+	assert.ErrorIs(t, r.Set(ctx, "missing", "v", cache.WithSetXX()), cache.NotStored)
+}
+
+func TestRedis_SetWithTTL(t *testing.T) {
+	r, mr := newTestRedis(t, "app")
+	ctx := context.Background()
+	require.NoError(t, r.Set(ctx, "key", "value", cache.WithTTL(time.Minute)))
+
+	var v string
+	assert.NoError(t, r.Get(ctx, "key", &v))
+	assert.Equal(t, "value", v)
+
+	mr.FastForward(2 * time.Minute)
+	assert.Equal(t, cache.Nil, r.Get(ctx, "key", &v))
+}
+
+func TestRedis_SlidingExpiration(t *testing.T) {
+	r, mr := newTestRedis(t, "app")
+	r.Ttl = time.Minute
+	ctx := context.Background()
+	require.NoError(t, r.Set(ctx, "key", "value"))
+
+	var v string
+	for i := 0; i < 4; i++ {
+		mr.FastForward(40 * time.Second)
+		assert.NoError(t, r.Get(ctx, "key", &v, cache.WithSlidingExpiration()))
+	}
+	mr.FastForward(70 * time.Second)
+	assert.Equal(t, cache.Nil, r.Get(ctx, "key", &v))
+}
+
+func TestRedis_StaleWhileRevalidate(t *testing.T) {
+	r, mr := newTestRedis(t, "app")
+	r.Ttl = time.Minute
+	ctx := context.Background()
+	var refreshes int32
+	swr := cache.WithStaleWhileRevalidate(time.Minute, func(ctx context.Context, key string) (interface{}, error) {
+		atomic.AddInt32(&refreshes, 1)
+		return "new", nil
+	})
+	require.NoError(t, r.Set(ctx, "key", "old", swr))
+
+	var v string
+	assert.NoError(t, r.Get(ctx, "key", &v, swr))
+	assert.Equal(t, "old", v)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&refreshes))
+
+	mr.FastForward(70 * time.Second)
+	assert.NoError(t, r.Get(ctx, "key", &v, swr))
+	assert.Equal(t, "old", v)
+	assert.Eventually(t, func() bool {
+		return r.Get(ctx, "key", &v, swr) == nil && v == "new"
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&refreshes))
+}
+
+func TestRedis_StaleWhileRevalidateLostMarker(t *testing.T) {
+	r, mr := newTestRedis(t, "app")
+	r.Ttl = time.Minute
+	ctx := context.Background()
+	swr := cache.WithStaleWhileRevalidate(time.Minute, func(ctx context.Context, key string) (interface{}, error) {
+		t.Error("a fresh value must not be refreshed")
+		return nil, nil
+	})
+	require.NoError(t, r.Set(ctx, "key", "value", swr))
+	mr.Del(cache.FreshKey(r.cacheKey("key")))
+
+	var v string
+	assert.NoError(t, r.Get(ctx, "key", &v, swr))
+	assert.True(t, mr.Exists(cache.FreshKey(r.cacheKey("key"))))
+	assert.LessOrEqual(t, mr.TTL(cache.FreshKey(r.cacheKey("key"))), time.Minute)
+}
@@ -0,0 +1,145 @@
+package redis_cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/best-expendables-v2/common-utils/cache"
+)
+
+const defaultWarmupConcurrency = 8
+
+// Warmer lists the keys of one prefix and loads the value of each of them,
+// typically from the database.
+type Warmer interface {
+	Keys(ctx context.Context) ([]string, error)
+	Load(ctx context.Context, key string) (interface{}, error)
+}
+
+type funcWarmer struct {
+	keys func(ctx context.Context) ([]string, error)
+	load func(ctx context.Context, key string) (interface{}, error)
+}
+
+func NewWarmer(keys func(ctx context.Context) ([]string, error), load func(ctx context.Context, key string) (interface{}, error)) Warmer {
+	return funcWarmer{keys: keys, load: load}
+}
+
+func (w funcWarmer) Keys(ctx context.Context) ([]string, error) {
+	return w.keys(ctx)
+}
+
+func (w funcWarmer) Load(ctx context.Context, key string) (interface{}, error) {
+	return w.load(ctx, key)
+}
+
+type warmupEntry struct {
+	cache  *Redis
+	warmer Warmer
+}
+
+type warmupJob struct {
+	entry warmupEntry
+	key   string
+}
+
+// Warmup preloads caches at startup, running at most concurrency loads at a time.
+type Warmup struct {
+	concurrency int
+	entries     map[string]warmupEntry
+	order       []string
+}
+
+func NewWarmup(concurrency int) *Warmup {
+	if concurrency < 1 {
+		concurrency = defaultWarmupConcurrency
+	}
+	return &Warmup{
+		concurrency: concurrency,
+		entries:     map[string]warmupEntry{},
+	}
+}
+
+// Register sets the warmer of the prefix of c, replacing any previous one.
+func (w *Warmup) Register(c *Redis, warmer Warmer) *Warmup {
+	if _, ok := w.entries[c.Prefix]; !ok {
+		w.order = append(w.order, c.Prefix)
+	}
+	w.entries[c.Prefix] = warmupEntry{cache: c, warmer: warmer}
+	return w
+}
+
+// Run loads every registered prefix. Keys that already exist are left
+// untouched so a warmup never overwrites fresher values. Failing keys do not
+// stop the warmup; the first failure is returned once all loads are done.
+func (w *Warmup) Run(ctx context.Context) error {
+	jobs := make(chan warmupJob)
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		failed   int
+		total    int
+		firstErr error
+	)
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failed++
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for i := 0; i < w.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				obj, err := job.entry.warmer.Load(ctx, job.key)
+				if err == nil {
+					err = job.entry.cache.Set(ctx, job.key, obj, cache.WithSetNX())
+				}
+				if err != nil && err != cache.NotStored {
+					fail(fmt.Errorf("%s/%s: %w", job.entry.cache.Prefix, job.key, err))
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for _, prefix := range w.order {
+		if ctx.Err() != nil {
+			break
+		}
+		entry := w.entries[prefix]
+		keys, err := entry.warmer.Keys(ctx)
+		if err != nil {
+			fail(fmt.Errorf("%s: %w", prefix, err))
+			continue
+		}
+		for _, key := range keys {
+			// select picks randomly among ready cases, a free worker must
+			// not get a job once ctx is done.
+			if ctx.Err() != nil {
+				break dispatch
+			}
+			select {
+			case jobs <- warmupJob{entry: entry, key: key}:
+				total++
+			case <-ctx.Done():
+				break dispatch
+			}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if firstErr != nil {
+		return fmt.Errorf("redis_cache: warmup failed for %d of %d entries: %w", failed, total, firstErr)
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package redis_cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRedis(t *testing.T, prefix string) (*Redis, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return NewRedis(client, prefix, time.Hour), mr
+}
+
+func keys(keys ...string) func(ctx context.Context) ([]string, error) {
+	return func(ctx context.Context) ([]string, error) {
+		return keys, nil
+	}
+}
+
+func TestWarmup_RunSkipsExistingKeys(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestRedis(t, "products")
+	require.NoError(t, c.Set(ctx, "1", "fresh"))
+
+	err := NewWarmup(2).Register(c, NewWarmer(keys("1", "2"), func(ctx context.Context, key string) (interface{}, error) {
+		return "loaded " + key, nil
+	})).Run(ctx)
+	assert.NoError(t, err)
+
+	var value string
+	require.NoError(t, c.Get(ctx, "1", &value))
+	assert.Equal(t, "fresh", value)
+	require.NoError(t, c.Get(ctx, "2", &value))
+	assert.Equal(t, "loaded 2", value)
+}
+
+func TestWarmup_RunBoundsConcurrency(t *testing.T) {
+	c, _ := newTestRedis(t, "products")
+	var running, maxRunning int32
+	load := func(ctx context.Context, key string) (interface{}, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		return key, nil
+	}
+
+	err := NewWarmup(3).Register(c, NewWarmer(keys("1", "2", "3", "4", "5", "6", "7", "8", "9"), load)).Run(context.Background())
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, maxRunning, int32(3))
+	assert.Greater(t, maxRunning, int32(1))
+}
+
+func TestWarmup_RunAggregatesErrors(t *testing.T) {
+	products, _ := newTestRedis(t, "products")
+	users := &Redis{Client: products.Client, Cache: products.Cache, Prefix: "users", Ttl: time.Hour}
+	errLoad := errors.New("load failed")
+	errKeys := errors.New("keys failed")
+
+	err := NewWarmup(2).
+		Register(users, NewWarmer(func(ctx context.Context) ([]string, error) {
+			return nil, errKeys
+		}, nil)).
+		Register(products, NewWarmer(keys("1", "2", "3"), func(ctx context.Context, key string) (interface{}, error) {
+			if key == "2" {
+				return nil, errLoad
+			}
+			return key, nil
+		})).
+		Run(context.Background())
+	assert.True(t, errors.Is(err, errKeys))
+	assert.Contains(t, err.Error(), "failed for 2 of 3 entries")
+
+	var value string
+	assert.NoError(t, products.Get(context.Background(), "3", &value))
+}
+
+func TestWarmup_RunStopsOnCancel(t *testing.T) {
+	c, _ := newTestRedis(t, "products")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mu sync.Mutex
+	var loaded []string
+	var listed int32
+
+	w := NewWarmup(1)
+	w.Register(c, NewWarmer(keys("1", "2", "3", "4"), func(ctx context.Context, key string) (interface{}, error) {
+		mu.Lock()
+		loaded = append(loaded, key)
+		mu.Unlock()
+		cancel()
+		return key, nil
+	}))
+	other := &Redis{Client: c.Client, Cache: c.Cache, Prefix: "users", Ttl: time.Hour}
+	w.Register(other, NewWarmer(func(ctx context.Context) ([]string, error) {
+		atomic.AddInt32(&listed, 1)
+		return nil, nil
+	}, nil))
+
+	assert.Equal(t, context.Canceled, w.Run(ctx))
+	assert.LessOrEqual(t, len(loaded), 2)
+	assert.Equal(t, int32(0), listed)
+}
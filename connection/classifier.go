@@ -0,0 +1,191 @@
+package connection
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+	"github.com/lib/pq"
+)
+
+// Backoff returns how long to wait before the given retry attempt, starting at 0.
+type Backoff func(attempt int) time.Duration
+
+func ConstantBackoff(delay time.Duration) Backoff {
+	return func(int) time.Duration {
+		return delay
+	}
+}
+
+// ExponentialBackoff doubles base on every attempt, capped at max when max > 0.
+func ExponentialBackoff(base, max time.Duration) Backoff {
+	return func(attempt int) time.Duration {
+		delay := base
+		for i := 0; i < attempt; i++ {
+			delay *= 2
+			if max > 0 && delay >= max {
+				return max
+			}
+		}
+		if max > 0 && delay > max {
+			return max
+		}
+		return delay
+	}
+}
+
+// RetryRule describes a class of errors that may be retried and how.
+type RetryRule struct {
+	Name     string
+	Match    func(err error) bool
+	Attempts int
+	Backoff  Backoff
+}
+
+type ErrorClassifier interface {
+	// Classify returns the rule of the first matching class of err, if any.
+	Classify(err error) (RetryRule, bool)
+}
+
+type Classifier struct {
+	mu    sync.RWMutex
+	rules []RetryRule
+}
+
+func NewClassifier(rules ...RetryRule) *Classifier {
+	return &Classifier{rules: rules}
+}
+
+// NewDefaultClassifier recognises deadlocks, serialization failures and lost
+// connections of Postgres and MySQL/MariaDB.
+func NewDefaultClassifier(attempts int, backoff Backoff) *Classifier {
+	return NewClassifier(DefaultRetryRules(attempts, backoff)...)
+}
+
+func DefaultRetryRules(attempts int, backoff Backoff) []RetryRule {
+	return []RetryRule{
+		{
+			Name:     "postgres: serialization failure, deadlock or admin shutdown",
+			Match:    MatchPostgresCodes("40001", "40P01", "57P01"),
+			Attempts: attempts,
+			Backoff:  backoff,
+		},
+		{
+			Name:     "mysql: deadlock or lock wait timeout",
+			Match:    MatchMySQLNumbers(1213, 1205),
+			Attempts: attempts,
+			Backoff:  backoff,
+		},
+		{
+			Name:     "bad connection",
+			Match:    MatchErrors(driver.ErrBadConn),
+			Attempts: attempts,
+			Backoff:  backoff,
+		},
+		{
+			Name:     "network",
+			Match:    MatchMessages("connection reset by peer", "write: broken pipe", "connection refused"),
+			Attempts: attempts,
+			Backoff:  backoff,
+		},
+	}
+}
+
+// Register adds rules that take precedence over the ones already known.
+func (c *Classifier) Register(rules ...RetryRule) *Classifier {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rules = append(append([]RetryRule{}, rules...), c.rules...)
+	return c
+}
+
+func (c *Classifier) Classify(err error) (RetryRule, bool) {
+	if err == nil {
+		return RetryRule{}, false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, rule := range c.rules {
+		if rule.Match != nil && rule.Match(err) {
+			return rule, true
+		}
+	}
+	return RetryRule{}, false
+}
+
+// MatchPostgresCodes matches pgx and lib/pq errors by SQLSTATE.
+func MatchPostgresCodes(codes ...string) func(err error) bool {
+	return func(err error) bool {
+		code := postgresCode(err)
+		if code == "" {
+			return false
+		}
+		for _, c := range codes {
+			if c == code {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchMySQLNumbers matches MySQL/MariaDB server errors by error number.
+func MatchMySQLNumbers(numbers ...uint16) func(err error) bool {
+	return func(err error) bool {
+		var mysqlErr *mysql.MySQLError
+		if !errors.As(err, &mysqlErr) {
+			return false
+		}
+		for _, n := range numbers {
+			if n == mysqlErr.Number {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchErrors matches err against targets with errors.Is.
+func MatchErrors(targets ...error) func(err error) bool {
+	return func(err error) bool {
+		for _, target := range targets {
+			if errors.Is(err, target) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchMessages matches errors whose message contains any of substrings.
+func MatchMessages(substrings ...string) func(err error) bool {
+	return func(err error) bool {
+		msg := err.Error()
+		for _, s := range substrings {
+			if strings.Contains(msg, s) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func postgresCode(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	var pqErrPtr *pq.Error
+	if errors.As(err, &pqErrPtr) {
+		return string(pqErrPtr.Code)
+	}
+	var pqErr pq.Error
+	if errors.As(err, &pqErr) {
+		return string(pqErr.Code)
+	}
+	return ""
+}
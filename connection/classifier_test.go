@@ -0,0 +1,65 @@
+package connection
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultClassifier(t *testing.T) {
+	classifier := NewDefaultClassifier(3, ConstantBackoff(time.Millisecond))
+	cases := []struct {
+		err       error
+		retryable bool
+	}{
+		{&pgconn.PgError{Code: "40001"}, true},
+		{fmt.Errorf("wrapped: %w", &pgconn.PgError{Code: "40P01"}), true},
+		{&pq.Error{Code: "57P01"}, true},
+		{&pgconn.PgError{Code: "23505"}, false},
+		{&mysql.MySQLError{Number: 1213}, true},
+		{&mysql.MySQLError{Number: 1205}, true},
+		{&mysql.MySQLError{Number: 1062}, false},
+		{driver.ErrBadConn, true},
+		{errors.New("read tcp: connection reset by peer"), true},
+		{errors.New("record not found"), false},
+	}
+	for _, c := range cases {
+		_, ok := classifier.Classify(c.err)
+		assert.Equal(t, c.retryable, ok, c.err.Error())
+	}
+}
+
+func TestClassifier_Register(t *testing.T) {
+	classifier := NewDefaultClassifier(3, ConstantBackoff(time.Millisecond))
+	classifier.Register(RetryRule{
+		Name:     "custom deadlock",
+		Match:    MatchPostgresCodes("40P01"),
+		Attempts: 10,
+		Backoff:  ConstantBackoff(time.Second),
+	})
+
+	rule, ok := classifier.Classify(&pgconn.PgError{Code: "40P01"})
+	assert.True(t, ok)
+	assert.Equal(t, "custom deadlock", rule.Name)
+	assert.Equal(t, 10, rule.Attempts)
+
+	rule, ok = classifier.Classify(&pgconn.PgError{Code: "40001"})
+	assert.True(t, ok)
+	assert.Equal(t, 3, rule.Attempts)
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff(100*time.Millisecond, time.Second)
+	assert.Equal(t, 100*time.Millisecond, backoff(0))
+	assert.Equal(t, 200*time.Millisecond, backoff(1))
+	assert.Equal(t, 800*time.Millisecond, backoff(3))
+	assert.Equal(t, time.Second, backoff(4))
+	assert.Equal(t, time.Second, backoff(40))
+}
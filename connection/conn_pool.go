@@ -17,7 +17,7 @@ func (s *ConnPool) String() string {
 
 func (s ConnPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
 	result, err := s.ConnPool.PrepareContext(ctx, query)
-	err = s.pluginRetry.retry(func() error {
+	err = s.pluginRetry.retry(ctx, func() error {
 		result, err = s.ConnPool.PrepareContext(ctx, query)
 		return err
 	}, err)
@@ -26,7 +26,7 @@ func (s ConnPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt,
 
 func (s ConnPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
 	result, err := s.ConnPool.ExecContext(ctx, query, args...)
-	err = s.pluginRetry.retry(func() error {
+	err = s.pluginRetry.retry(ctx, func() error {
 		result, err = s.ConnPool.ExecContext(ctx, query, args...)
 		return err
 	}, err)
@@ -35,33 +35,56 @@ func (s ConnPool) ExecContext(ctx context.Context, query string, args ...interfa
 
 func (s ConnPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
 	result, err := s.ConnPool.QueryContext(ctx, query, args...)
-	err = s.pluginRetry.retry(func() error {
+	err = s.pluginRetry.retry(ctx, func() error {
 		result, err = s.ConnPool.QueryContext(ctx, query, args...)
 		return err
 	}, err)
 	return result, err
 }
 
+// QueryRowContext checks the deferred error of the row before handing it
+// out, so failed row queries are retried like the others.
 func (s ConnPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
-	return s.ConnPool.QueryRowContext(ctx, query, args...)
+	row := s.ConnPool.QueryRowContext(ctx, query, args...)
+	_ = s.pluginRetry.retry(ctx, func() error {
+		row = s.ConnPool.QueryRowContext(ctx, query, args...)
+		return row.Err()
+	}, row.Err())
+	return row
 }
 
+// BeginTx starts a transaction on the underlying pool, retrying the BEGIN
+// itself. Statements of the transaction run through a TxConnPool.
 func (s *ConnPool) BeginTx(ctx context.Context, opt *sql.TxOptions) (gorm.ConnPool, error) {
-	if basePool, ok := s.ConnPool.(gorm.ConnPoolBeginner); ok {
-		result, err := basePool.BeginTx(ctx, opt)
-		err = s.pluginRetry.retry(func() error {
-			result, err = basePool.BeginTx(ctx, opt)
-			return err
-		}, err)
-		return result, err
+	tx, err := s.beginTx(ctx, opt)
+	err = s.pluginRetry.retry(ctx, func() error {
+		tx, err = s.beginTx(ctx, opt)
+		return err
+	}, err)
+	if err != nil {
+		return nil, err
+	}
+	return &TxConnPool{ConnPool: tx, pluginRetry: s.pluginRetry}, nil
+}
+
+func (s *ConnPool) beginTx(ctx context.Context, opt *sql.TxOptions) (gorm.ConnPool, error) {
+	switch basePool := s.ConnPool.(type) {
+	case gorm.TxBeginner:
+		tx, err := basePool.BeginTx(ctx, opt)
+		if err != nil {
+			return nil, err
+		}
+		return tx, nil
+	case gorm.ConnPoolBeginner:
+		return basePool.BeginTx(ctx, opt)
 	}
-	return s, nil
+	return nil, gorm.ErrInvalidTransaction
 }
 
 func (s *ConnPool) Commit() error {
 	if basePool, ok := s.ConnPool.(gorm.TxCommitter); ok {
 		err := basePool.Commit()
-		err = s.pluginRetry.retry(func() error {
+		err = s.pluginRetry.retry(context.Background(), func() error {
 			err = basePool.Commit()
 			return err
 		}, err)
@@ -73,7 +96,7 @@ func (s *ConnPool) Commit() error {
 func (s *ConnPool) Rollback() error {
 	if basePool, ok := s.ConnPool.(gorm.TxCommitter); ok {
 		err := basePool.Rollback()
-		err = s.pluginRetry.retry(func() error {
+		err = s.pluginRetry.retry(context.Background(), func() error {
 			err = basePool.Rollback()
 			return err
 		}, err)
@@ -0,0 +1,235 @@
+package connection
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/best-expendables-v2/common-utils/util/response"
+	"github.com/go-chi/chi"
+	"gorm.io/gorm"
+)
+
+const (
+	StatusUp       = "up"
+	StatusDegraded = "degraded"
+	StatusDown     = "down"
+)
+
+const defaultHealthTimeout = 2 * time.Second
+
+type PoolStats struct {
+	MaxOpenConnections int   `json:"max_open_connections"`
+	OpenConnections    int   `json:"open_connections"`
+	InUse              int   `json:"in_use"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"wait_count"`
+	WaitDurationMs     int64 `json:"wait_duration_ms"`
+	MaxIdleClosed      int64 `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64 `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64 `json:"max_lifetime_closed"`
+}
+
+func newPoolStats(s sql.DBStats) PoolStats {
+	return PoolStats{
+		MaxOpenConnections: s.MaxOpenConnections,
+		OpenConnections:    s.OpenConnections,
+		InUse:              s.InUse,
+		Idle:               s.Idle,
+		WaitCount:          s.WaitCount,
+		WaitDurationMs:     s.WaitDuration.Milliseconds(),
+		MaxIdleClosed:      s.MaxIdleClosed,
+		MaxIdleTimeClosed:  s.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  s.MaxLifetimeClosed,
+	}
+}
+
+type DatabaseHealth struct {
+	Name             string    `json:"name"`
+	Status           string    `json:"status"`
+	Error            string    `json:"error,omitempty"`
+	LatencyMs        int64     `json:"latency_ms"`
+	ReplicationLagMs *int64    `json:"replication_lag_ms,omitempty"`
+	Stats            PoolStats `json:"stats"`
+}
+
+// HealthReport is down when the primary is, and degraded when only replicas
+// are, since reads then fall back to the primary.
+type HealthReport struct {
+	Status    string           `json:"status"`
+	Databases []DatabaseHealth `json:"databases"`
+}
+
+type healthTarget struct {
+	name    string
+	db      *gorm.DB
+	replica bool
+}
+
+type HealthChecker struct {
+	primary  healthTarget
+	replicas []healthTarget
+	timeout  time.Duration
+	query    string
+	maxLag   time.Duration
+	lagFunc  func(ctx context.Context, db *gorm.DB) (time.Duration, error)
+}
+
+type HealthOption func(*HealthChecker)
+
+func WithHealthTimeout(timeout time.Duration) HealthOption {
+	return func(h *HealthChecker) {
+		h.timeout = timeout
+	}
+}
+
+// WithHealthQuery runs query after the ping, e.g. to check a table is readable.
+func WithHealthQuery(query string) HealthOption {
+	return func(h *HealthChecker) {
+		h.query = query
+	}
+}
+
+// WithHealthReplica reports db as a replica, including its replication lag.
+func WithHealthReplica(name string, db *gorm.DB) HealthOption {
+	return func(h *HealthChecker) {
+		h.replicas = append(h.replicas, healthTarget{name: name, db: db, replica: true})
+	}
+}
+
+// WithHealthMaxReplicationLag marks replicas lagging more than maxLag as down.
+func WithHealthMaxReplicationLag(maxLag time.Duration) HealthOption {
+	return func(h *HealthChecker) {
+		h.maxLag = maxLag
+	}
+}
+
+func WithHealthReplicationLagFunc(fn func(ctx context.Context, db *gorm.DB) (time.Duration, error)) HealthOption {
+	return func(h *HealthChecker) {
+		h.lagFunc = fn
+	}
+}
+
+func NewHealthChecker(primary *gorm.DB, opts ...HealthOption) *HealthChecker {
+	h := &HealthChecker{
+		primary: healthTarget{name: "primary", db: primary},
+		timeout: defaultHealthTimeout,
+		lagFunc: ReplicationLag,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// Live only pings the primary.
+func (h *HealthChecker) Live(ctx context.Context) HealthReport {
+	health := h.checkPing(ctx, h.primary)
+	return HealthReport{Status: health.Status, Databases: []DatabaseHealth{health}}
+}
+
+// Check pings every database, runs the health query and measures the
+// replication lag of the replicas.
+func (h *HealthChecker) Check(ctx context.Context) HealthReport {
+	targets := append([]healthTarget{h.primary}, h.replicas...)
+	databases := make([]DatabaseHealth, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target healthTarget) {
+			defer wg.Done()
+			databases[i] = h.check(ctx, target)
+		}(i, target)
+	}
+	wg.Wait()
+
+	report := HealthReport{Status: StatusUp, Databases: databases}
+	for _, database := range databases[1:] {
+		if database.Status != StatusUp {
+			report.Status = StatusDegraded
+		}
+	}
+	if databases[0].Status != StatusUp {
+		report.Status = StatusDown
+	}
+	return report
+}
+
+func (h *HealthChecker) check(ctx context.Context, target healthTarget) DatabaseHealth {
+	health := h.checkPing(ctx, target)
+	if health.Status != StatusUp {
+		return health
+	}
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	if h.query != "" {
+		if err := target.db.WithContext(ctx).Exec(h.query).Error; err != nil {
+			return health.down(err)
+		}
+	}
+	if target.replica {
+		lag, err := h.lagFunc(ctx, target.db)
+		if err != nil {
+			return health.down(err)
+		}
+		lagMs := lag.Milliseconds()
+		health.ReplicationLagMs = &lagMs
+		if h.maxLag > 0 && lag > h.maxLag {
+			health.Status = StatusDown
+			health.Error = "replication lag exceeds " + h.maxLag.String()
+		}
+	}
+	return health
+}
+
+func (h *HealthChecker) checkPing(ctx context.Context, target healthTarget) DatabaseHealth {
+	health := DatabaseHealth{Name: target.name, Status: StatusUp}
+	sqlDB, err := target.db.DB()
+	if err != nil {
+		return health.down(err)
+	}
+	health.Stats = newPoolStats(sqlDB.Stats())
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	start := time.Now()
+	err = sqlDB.PingContext(ctx)
+	health.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		return health.down(err)
+	}
+	return health
+}
+
+func (d DatabaseHealth) down(err error) DatabaseHealth {
+	d.Status = StatusDown
+	d.Error = err.Error()
+	return d
+}
+
+// Routes serves /live and /ready, e.g. r.Mount("/health", checker.Routes()).
+func (h *HealthChecker) Routes() http.Handler {
+	r := chi.NewRouter()
+	r.Get("/live", h.LiveHandler)
+	r.Get("/ready", h.ReadyHandler)
+	return r
+}
+
+func (h *HealthChecker) LiveHandler(w http.ResponseWriter, r *http.Request) {
+	renderHealth(w, h.Live(r.Context()))
+}
+
+func (h *HealthChecker) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	renderHealth(w, h.Check(r.Context()))
+}
+
+func renderHealth(w http.ResponseWriter, report HealthReport) {
+	res := response.Ok(report)
+	if report.Status == StatusDown {
+		res.Code = http.StatusServiceUnavailable
+	}
+	response.RenderJson(w, res)
+}
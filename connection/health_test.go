@@ -0,0 +1,63 @@
+package connection
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestHealthChecker_Check(t *testing.T) {
+	primary, primaryMock := openResolverMockDB(t)
+	replica, replicaMock := openResolverMockDB(t)
+	checker := NewHealthChecker(primary,
+		WithHealthQuery("SELECT 1"),
+		WithHealthReplica("replica", replica),
+		WithHealthMaxReplicationLag(time.Second),
+		WithHealthReplicationLagFunc(func(ctx context.Context, db *gorm.DB) (time.Duration, error) {
+			return time.Minute, nil
+		}),
+	)
+
+	primaryMock.ExpectPing()
+	primaryMock.ExpectExec("SELECT 1").WillReturnResult(sqlmock.NewResult(0, 0))
+	replicaMock.ExpectPing()
+	replicaMock.ExpectExec("SELECT 1").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	report := checker.Check(context.Background())
+	assert.Equal(t, StatusDegraded, report.Status)
+	assert.Equal(t, StatusUp, report.Databases[0].Status)
+	assert.Equal(t, StatusDown, report.Databases[1].Status)
+	assert.Equal(t, int64(60000), *report.Databases[1].ReplicationLagMs)
+	assert.NoError(t, primaryMock.ExpectationsWereMet())
+	assert.NoError(t, replicaMock.ExpectationsWereMet())
+}
+
+func TestHealthChecker_Routes(t *testing.T) {
+	primary, primaryMock := openResolverMockDB(t)
+	handler := NewHealthChecker(primary).Routes()
+
+	primaryMock.ExpectPing()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	primaryMock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/live", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	var body struct {
+		Data HealthReport `json:"data"`
+	}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	assert.Equal(t, StatusDown, body.Data.Status)
+	assert.Equal(t, "connection refused", body.Data.Databases[0].Error)
+}
@@ -0,0 +1,273 @@
+package connection
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/joho/godotenv"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+	gormmysql "gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+const (
+	Postgres = "postgres"
+	MySQL    = "mysql"
+	MariaDB  = "mariadb"
+)
+
+const maxStartupBackoff = 30 * time.Second
+
+const (
+	defaultMaxOpenConns    = 25
+	defaultMaxIdleConns    = 25
+	defaultConnMaxLifetime = 30 * time.Minute
+	defaultConnMaxIdleTime = 5 * time.Minute
+)
+
+var ErrUnsupportedDialect = errors.New("unsupported database dialect")
+
+type PoolConfig struct {
+	MaxOpenConns    int           `envconfig:"DB_MAX_OPEN_CONNS" default:"25"`
+	MaxIdleConns    int           `envconfig:"DB_MAX_IDLE_CONNS" default:"25"`
+	ConnMaxLifetime time.Duration `envconfig:"DB_CONN_MAX_LIFETIME" default:"30m"`
+	ConnMaxIdleTime time.Duration `envconfig:"DB_CONN_MAX_IDLE_TIME" default:"5m"`
+}
+
+// withDefaults fills the zero settings with the defaults of the DB_* variables,
+// a zero MaxOpenConns would lift the limit and a zero MaxIdleConns disable
+// the idle pool.
+func (p PoolConfig) withDefaults() PoolConfig {
+	if p.MaxOpenConns == 0 {
+		p.MaxOpenConns = defaultMaxOpenConns
+	}
+	if p.MaxIdleConns == 0 {
+		p.MaxIdleConns = defaultMaxIdleConns
+	}
+	if p.ConnMaxLifetime == 0 {
+		p.ConnMaxLifetime = defaultConnMaxLifetime
+	}
+	if p.ConnMaxIdleTime == 0 {
+		p.ConnMaxIdleTime = defaultConnMaxIdleTime
+	}
+	return p
+}
+
+// Config describes a Postgres, MySQL or MariaDB database. DSN, when set, is
+// used as is instead of the structured fields. SSLMode takes the Postgres
+// sslmode values, mapped to the tls parameter for MySQL and MariaDB.
+type Config struct {
+	Dialect  string            `envconfig:"DB_DIALECT" default:"postgres"`
+	DSN      string            `envconfig:"DB_DSN"`
+	Host     string            `envconfig:"DB_HOST" default:"localhost"`
+	Port     int               `envconfig:"DB_PORT"`
+	User     string            `envconfig:"DB_USER"`
+	Password string            `envconfig:"DB_PASSWORD"`
+	Name     string            `envconfig:"DB_NAME"`
+	SSLMode  string            `envconfig:"DB_SSL_MODE"`
+	Params   map[string]string `envconfig:"DB_PARAMS"`
+	// StatementTimeout aborts statements running longer than it on the server.
+	StatementTimeout time.Duration `envconfig:"DB_STATEMENT_TIMEOUT"`
+	PoolConfig
+	// StartupAttempts bounds the pings done by Open before giving up.
+	StartupAttempts int           `envconfig:"DB_STARTUP_ATTEMPTS" default:"5"`
+	StartupBackoff  time.Duration `envconfig:"DB_STARTUP_BACKOFF" default:"1s"`
+	// Retry configures the retry plugin, RegisterRetry is used when nil.
+	Retry *RetryConfig `ignored:"true"`
+	Gorm  *gorm.Config `ignored:"true"`
+}
+
+// LoadConfigFromEnv reads the DB_* variables, loading a .env file first when
+// there is one.
+func LoadConfigFromEnv() (Config, error) {
+	var config Config
+	_ = godotenv.Load()
+	err := envconfig.Process("", &config)
+	return config, err
+}
+
+func (c Config) DataSourceName() (string, error) {
+	if c.DSN != "" {
+		return c.DSN, nil
+	}
+	switch c.Dialect {
+	case Postgres:
+		return c.postgresDSN(), nil
+	case MySQL, MariaDB:
+		return c.mysqlDSN(), nil
+	}
+	return "", errors.Wrap(ErrUnsupportedDialect, c.Dialect)
+}
+
+func (c Config) postgresDSN() string {
+	query := url.Values{}
+	for k, v := range c.Params {
+		query.Set(k, v)
+	}
+	if c.SSLMode != "" {
+		query.Set("sslmode", c.SSLMode)
+	}
+	if c.StatementTimeout > 0 {
+		query.Set("statement_timeout", strconv.FormatInt(c.StatementTimeout.Milliseconds(), 10))
+	}
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(c.User, c.Password),
+		Host:     net.JoinHostPort(c.Host, strconv.Itoa(c.port(5432))),
+		Path:     "/" + c.Name,
+		RawQuery: query.Encode(),
+	}
+	return dsn.String()
+}
+
+func (c Config) mysqlDSN() string {
+	cfg := mysql.NewConfig()
+	cfg.User = c.User
+	cfg.Passwd = c.Password
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(c.Host, strconv.Itoa(c.port(3306)))
+	cfg.DBName = c.Name
+	cfg.ParseTime = true
+	cfg.TLSConfig = mysqlTLS(c.SSLMode)
+	cfg.Params = map[string]string{}
+	for k, v := range c.Params {
+		cfg.Params[k] = v
+	}
+	if c.StatementTimeout > 0 {
+		// Unknown params are sent as session variables, and MariaDB names
+		// the timeout differently and counts it in seconds.
+		if c.Dialect == MariaDB {
+			cfg.Params["max_statement_time"] = strconv.FormatFloat(c.StatementTimeout.Seconds(), 'f', -1, 64)
+		} else {
+			cfg.Params["max_execution_time"] = strconv.FormatInt(c.StatementTimeout.Milliseconds(), 10)
+		}
+	}
+	return cfg.FormatDSN()
+}
+
+// mysqlTLS maps a Postgres sslmode to the tls parameter of the MySQL driver.
+func mysqlTLS(sslMode string) string {
+	switch sslMode {
+	case "disable":
+		return "false"
+	case "allow", "prefer":
+		return "preferred"
+	case "require":
+		return "skip-verify"
+	case "verify-ca", "verify-full":
+		return "true"
+	}
+	return sslMode
+}
+
+func (c Config) port(defaultPort int) int {
+	if c.Port > 0 {
+		return c.Port
+	}
+	return defaultPort
+}
+
+func (c Config) Dialector() (gorm.Dialector, error) {
+	dsn, err := c.DataSourceName()
+	if err != nil {
+		return nil, err
+	}
+	switch c.Dialect {
+	case Postgres:
+		return postgres.Open(dsn), nil
+	case MySQL, MariaDB:
+		return gormmysql.Open(dsn), nil
+	}
+	return nil, errors.Wrap(ErrUnsupportedDialect, c.Dialect)
+}
+
+// DB is a database opened by Open.
+type DB struct {
+	*gorm.DB
+	sqlDB *sql.DB
+}
+
+// Close stops new queries and waits for the in-flight ones until ctx is done.
+func (d *DB) Close(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- d.sqlDB.Close()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Open connects to the database described by config, applies the pool
+// settings, registers the retry plugin and pings the database until it
+// answers or the startup attempts are exhausted.
+func Open(ctx context.Context, config Config) (*DB, error) {
+	dialector, err := config.Dialector()
+	if err != nil {
+		return nil, err
+	}
+	gormConfig := &gorm.Config{}
+	if config.Gorm != nil {
+		*gormConfig = *config.Gorm
+	}
+	gormConfig.DisableAutomaticPing = true
+	db, err := gorm.Open(dialector, gormConfig)
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	pool := config.PoolConfig.withDefaults()
+	sqlDB.SetMaxOpenConns(pool.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(pool.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+
+	var retry PluginRetry
+	if config.Retry != nil {
+		retry = RegisterRetryWithConfig(*config.Retry)
+	} else {
+		retry = RegisterRetry()
+	}
+	if err := db.Use(retry); err != nil {
+		_ = sqlDB.Close()
+		return nil, err
+	}
+	if err := ping(ctx, sqlDB, config); err != nil {
+		_ = sqlDB.Close()
+		return nil, err
+	}
+	return &DB{DB: db, sqlDB: sqlDB}, nil
+}
+
+func ping(ctx context.Context, sqlDB *sql.DB, config Config) error {
+	attempts := config.StartupAttempts
+	if attempts <= 0 {
+		attempts = 1
+	}
+	backoff := ExponentialBackoff(config.StartupBackoff, maxStartupBackoff)
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			if ctxErr := wait(ctx, backoff(i-1)); ctxErr != nil {
+				return errors.Wrap(err, ctxErr.Error())
+			}
+		}
+		if err = sqlDB.PingContext(ctx); err == nil {
+			return nil
+		}
+	}
+	return errors.Wrapf(err, "database is unreachable after %d attempts", attempts)
+}
@@ -0,0 +1,108 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_DataSourceName(t *testing.T) {
+	config := Config{
+		Host:             "db",
+		User:             "app",
+		Password:         "p@ss",
+		Name:             "orders",
+		SSLMode:          "disable",
+		StatementTimeout: 5 * time.Second,
+	}
+
+	config.Dialect = Postgres
+	dsn, err := config.DataSourceName()
+	assert.NoError(t, err)
+	assert.Equal(t, "postgres://app:p%40ss@db:5432/orders?sslmode=disable&statement_timeout=5000", dsn)
+
+	config.Dialect = MySQL
+	config.SSLMode = ""
+	dsn, err = config.DataSourceName()
+	assert.NoError(t, err)
+	assert.Equal(t, "app:p@ss@tcp(db:3306)/orders?parseTime=true&max_execution_time=5000", dsn)
+
+	config.Dialect = MariaDB
+	dsn, err = config.DataSourceName()
+	assert.NoError(t, err)
+	assert.Equal(t, "app:p@ss@tcp(db:3306)/orders?parseTime=true&max_statement_time=5", dsn)
+
+	config.SSLMode = "require"
+	dsn, err = config.DataSourceName()
+	assert.NoError(t, err)
+	assert.Equal(t, "app:p@ss@tcp(db:3306)/orders?parseTime=true&tls=skip-verify&max_statement_time=5", dsn)
+	_, err = mysql.ParseDSN(dsn)
+	assert.NoError(t, err)
+	config.SSLMode = ""
+
+	config.Dialect = "sqlite"
+	_, err = config.DataSourceName()
+	assert.True(t, errors.Is(err, ErrUnsupportedDialect))
+}
+
+func TestConfigDialector(t *testing.T) {
+	config := Config{Dialect: MySQL, DSN: "app:secret@tcp(db:3306)/orders"}
+	dialector, err := config.Dialector()
+	assert.NoError(t, err)
+	assert.Equal(t, "mysql", dialector.Name())
+
+	config.Dialect = "sqlite"
+	_, err = config.Dialector()
+	assert.True(t, errors.Is(err, ErrUnsupportedDialect))
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	t.Setenv("DB_DIALECT", MySQL)
+	t.Setenv("DB_MAX_OPEN_CONNS", "10")
+	t.Setenv("DB_STATEMENT_TIMEOUT", "2s")
+
+	config, err := LoadConfigFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, MySQL, config.Dialect)
+	assert.Equal(t, 10, config.MaxOpenConns)
+	assert.Equal(t, 25, config.MaxIdleConns)
+	assert.Equal(t, 2*time.Second, config.StatementTimeout)
+}
+
+func TestPoolConfig_withDefaults(t *testing.T) {
+	pool := PoolConfig{MaxOpenConns: 10}.withDefaults()
+	assert.Equal(t, PoolConfig{
+		MaxOpenConns:    10,
+		MaxIdleConns:    25,
+		ConnMaxLifetime: 30 * time.Minute,
+		ConnMaxIdleTime: 5 * time.Minute,
+	}, pool)
+}
+
+func TestOpenGivesUpAfterStartupAttempts(t *testing.T) {
+	config := Config{
+		Dialect:         Postgres,
+		Host:            "127.0.0.1",
+		Port:            1,
+		StartupAttempts: 2,
+		StartupBackoff:  time.Millisecond,
+	}
+	_, err := Open(context.Background(), config)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unreachable after 2 attempts")
+}
+
+func TestDB_Close(t *testing.T) {
+	sqlDB, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	mock.ExpectClose()
+
+	db := &DB{sqlDB: sqlDB}
+	assert.NoError(t, db.Close(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,203 @@
+package connection
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/best-expendables-v2/common-utils/util"
+	"github.com/best-expendables-v2/logger"
+	"github.com/best-expendables-v2/trace"
+	"github.com/joho/godotenv"
+	"github.com/kelseyhightower/envconfig"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultSlowThreshold = 200 * time.Millisecond
+	queryStartKey        = "query_log:start"
+)
+
+type QueryLogConfig struct {
+	SlowThreshold time.Duration `envconfig:"GORM_SLOW_QUERY_THRESHOLD" default:"200ms"`
+	// ExplainSampleRate is the share of slow Postgres SELECTs whose plan is
+	// logged, never in production.
+	ExplainSampleRate float64      `envconfig:"GORM_EXPLAIN_SAMPLE_RATE"`
+	Environment       string       `envconfig:"ENVIRONMENT"`
+	Metrics           QueryMetrics `ignored:"true"`
+}
+
+type QueryLogOption func(*QueryLogConfig)
+
+// LoadQueryLogConfigFromEnv reads GORM_SLOW_QUERY_THRESHOLD,
+// GORM_EXPLAIN_SAMPLE_RATE and ENVIRONMENT, loading a .env file first when
+// there is one.
+func LoadQueryLogConfigFromEnv() (QueryLogConfig, error) {
+	var config QueryLogConfig
+	_ = godotenv.Load()
+	err := envconfig.Process("", &config)
+	return config, err
+}
+
+func WithSlowThreshold(threshold time.Duration) QueryLogOption {
+	return func(c *QueryLogConfig) {
+		c.SlowThreshold = threshold
+	}
+}
+
+func WithQueryMetrics(metrics QueryMetrics) QueryLogOption {
+	return func(c *QueryLogConfig) {
+		c.Metrics = metrics
+	}
+}
+
+func WithExplainSampling(rate float64, environment string) QueryLogOption {
+	return func(c *QueryLogConfig) {
+		c.ExplainSampleRate = rate
+		c.Environment = environment
+	}
+}
+
+type pluginQueryLog struct {
+	config QueryLogConfig
+}
+
+// RegisterQueryLog creates a plugin recording the duration, rows affected,
+// table and operation of every statement and logging the slow ones.
+func RegisterQueryLog(opts ...QueryLogOption) gorm.Plugin {
+	return RegisterQueryLogWithConfig(QueryLogConfig{SlowThreshold: defaultSlowThreshold}, opts...)
+}
+
+// RegisterQueryLogWithConfig is RegisterQueryLog starting from config, e.g.
+// one of LoadQueryLogConfigFromEnv.
+func RegisterQueryLogWithConfig(config QueryLogConfig, opts ...QueryLogOption) gorm.Plugin {
+	for _, opt := range opts {
+		opt(&config)
+	}
+	if config.Metrics == nil {
+		config.Metrics = noopQueryMetrics{}
+	}
+	return pluginQueryLog{config: config}
+}
+
+func (p pluginQueryLog) Name() string {
+	return "gorm:query_log"
+}
+
+func (p pluginQueryLog) Initialize(db *gorm.DB) error {
+	callback := db.Callback()
+	errs := []error{
+		callback.Create().Before("gorm:create").Register("query_log:before_create", p.before),
+		callback.Create().After("gorm:create").Register("query_log:after_create", p.after("create")),
+		callback.Query().Before("gorm:query").Register("query_log:before_query", p.before),
+		callback.Query().After("gorm:query").Register("query_log:after_query", p.after("query")),
+		callback.Update().Before("gorm:update").Register("query_log:before_update", p.before),
+		callback.Update().After("gorm:update").Register("query_log:after_update", p.after("update")),
+		callback.Delete().Before("gorm:delete").Register("query_log:before_delete", p.before),
+		callback.Delete().After("gorm:delete").Register("query_log:after_delete", p.after("delete")),
+		callback.Row().Before("gorm:row").Register("query_log:before_row", p.before),
+		callback.Row().After("gorm:row").Register("query_log:after_row", p.after("row")),
+		callback.Raw().Before("gorm:raw").Register("query_log:before_raw", p.before),
+		callback.Raw().After("gorm:raw").Register("query_log:after_raw", p.after("raw")),
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p pluginQueryLog) before(db *gorm.DB) {
+	db.InstanceSet(queryStartKey, time.Now())
+}
+
+func (p pluginQueryLog) after(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		v, ok := db.InstanceGet(queryStartKey)
+		if !ok {
+			return
+		}
+		duration := time.Since(v.(time.Time))
+		err := db.Error
+		if err == gorm.ErrRecordNotFound {
+			err = nil
+		}
+		table := db.Statement.Table
+		p.config.Metrics.ObserveQuery(table, operation, duration, db.RowsAffected, err)
+		if duration < p.config.SlowThreshold {
+			return
+		}
+		p.logSlowQuery(db, operation, duration)
+	}
+}
+
+func (p pluginQueryLog) logSlowQuery(db *gorm.DB, operation string, duration time.Duration) {
+	ctx := db.Statement.Context
+	// The statement keeps its placeholders, bound arguments are never logged.
+	sql := db.Statement.SQL.String()
+	fields := logger.Fields{
+		"sql":         sql,
+		"args":        len(db.Statement.Vars),
+		"duration_ms": duration.Milliseconds(),
+		"rows":        db.RowsAffected,
+		"table":       db.Statement.Table,
+		"operation":   operation,
+		"request_id":  trace.RequestIDFromContext(ctx),
+		"user_id":     util.GetUserIDFromContext(ctx),
+	}
+	if db.Error != nil {
+		fields["error"] = db.Error.Error()
+	}
+	if p.shouldExplain(db, sql) {
+		if plan, err := explain(ctx, db, sql); err == nil {
+			fields["plan"] = plan
+		}
+	}
+	logger.EntryFromContextOrDefault(ctx).WithFields(fields).Warning("slow query")
+}
+
+func (p pluginQueryLog) shouldExplain(db *gorm.DB, sql string) bool {
+	if p.config.ExplainSampleRate <= 0 || isProduction(p.config.Environment) {
+		return false
+	}
+	if db.Error != nil || db.Dialector.Name() != "postgres" {
+		return false
+	}
+	// A failing EXPLAIN would abort the transaction of the caller.
+	if _, ok := db.Statement.ConnPool.(gorm.TxCommitter); ok {
+		return false
+	}
+	if !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(sql)), "SELECT") {
+		return false
+	}
+	return rand.Float64() < p.config.ExplainSampleRate
+}
+
+func isProduction(environment string) bool {
+	switch strings.ToLower(environment) {
+	case "prod", "production":
+		return true
+	}
+	return false
+}
+
+// explain bypasses gorm to not be logged itself, it never runs in a
+// transaction.
+func explain(ctx context.Context, db *gorm.DB, sql string) (string, error) {
+	rows, err := db.Statement.ConnPool.QueryContext(ctx, "EXPLAIN "+sql, db.Statement.Vars...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var lines []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return "", err
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), rows.Err()
+}
@@ -0,0 +1,112 @@
+package connection
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/best-expendables-v2/logger"
+	"github.com/best-expendables-v2/trace"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type queryLogProduct struct {
+	ID   string
+	Name string
+}
+
+func openQueryLogMockDB(t *testing.T, opts ...QueryLogOption) (*gorm.DB, sqlmock.Sqlmock) {
+	rawDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open mock sql db, got error: %v", err)
+	}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: rawDB}), &gorm.Config{SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(RegisterQueryLog(opts...)); err != nil {
+		t.Fatalf("Cannot register plugin: %v", err)
+	}
+	return db, mock
+}
+
+func TestQueryLog_Metrics(t *testing.T) {
+	stats := NewQueryStats()
+	db, mock := openQueryLogMockDB(t, WithQueryMetrics(stats))
+
+	mock.ExpectQuery(`SELECT \* FROM "query_log_products"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow("1", "a").AddRow("2", "b"))
+	mock.ExpectExec(`UPDATE "query_log_products"`).WillReturnResult(sqlmock.NewResult(0, 2))
+
+	var products []queryLogProduct
+	assert.NoError(t, db.Find(&products).Error)
+	assert.NoError(t, db.Model(&queryLogProduct{}).Where("1 = 1").Update("name", "c").Error)
+
+	snapshot := stats.Snapshot()
+	assert.Len(t, snapshot, 2)
+	assert.Equal(t, "query_log_products", snapshot[0].Table)
+	assert.Equal(t, "query", snapshot[0].Operation)
+	assert.Equal(t, int64(2), snapshot[0].RowsAffected)
+	assert.Equal(t, "update", snapshot[1].Operation)
+	assert.Equal(t, int64(1), snapshot[1].Count)
+}
+
+func TestQueryLog_SlowQuery(t *testing.T) {
+	var out bytes.Buffer
+	ctx := trace.ContextWithRequestID(context.Background(), "request-1")
+	ctx = logger.ContextWithEntry(logger.NewLoggerFactory(logger.DebugLevel, logger.SetOut(&out)).Logger(ctx), ctx)
+	db, mock := openQueryLogMockDB(t, WithSlowThreshold(0), WithExplainSampling(1, "staging"))
+
+	mock.ExpectQuery(`SELECT \* FROM "query_log_products" WHERE name = \$1`).WithArgs("secret").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow("1", "secret"))
+	mock.ExpectQuery(`EXPLAIN SELECT`).WithArgs("secret").
+		WillReturnRows(sqlmock.NewRows([]string{"QUERY PLAN"}).AddRow("Seq Scan on query_log_products"))
+
+	var products []queryLogProduct
+	assert.NoError(t, db.WithContext(ctx).Where("name = ?", "secret").Find(&products).Error)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	assert.Contains(t, out.String(), "slow query")
+	assert.Contains(t, out.String(), "request-1")
+	assert.Contains(t, out.String(), "Seq Scan on query_log_products")
+	assert.NotContains(t, out.String(), "secret")
+}
+
+func TestQueryLog_NoExplainInProduction(t *testing.T) {
+	db, mock := openQueryLogMockDB(t, WithSlowThreshold(0), WithExplainSampling(1, "production"))
+	mock.ExpectQuery(`SELECT`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	var products []queryLogProduct
+	assert.NoError(t, db.Find(&products).Error)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQueryLog_NoExplainInTransaction(t *testing.T) {
+	db, mock := openQueryLogMockDB(t, WithSlowThreshold(0), WithExplainSampling(1, "staging"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectCommit()
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var products []queryLogProduct
+		return tx.Find(&products).Error
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLoadQueryLogConfigFromEnv(t *testing.T) {
+	t.Setenv("GORM_SLOW_QUERY_THRESHOLD", "1s")
+	t.Setenv("GORM_EXPLAIN_SAMPLE_RATE", "0.5")
+	t.Setenv("ENVIRONMENT", "staging")
+
+	config, err := LoadQueryLogConfigFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, config.SlowThreshold)
+	assert.Equal(t, 0.5, config.ExplainSampleRate)
+	assert.Equal(t, "staging", config.Environment)
+}
@@ -1,25 +1,99 @@
 package connection
 
 import (
+	"context"
 	"database/sql"
 	"github.com/best-expendables-v2/logger"
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/pkg/errors"
 	"gorm.io/gorm"
-	"strings"
+	"os"
 	"time"
 )
 
-type retryMessage struct {
-	ErrMsgKey string
-	Retry     int
-	Delay     time.Duration
-}
+const (
+	defaultRetryAttempt = 3
+	defaultRetryDelay   = 100 * time.Millisecond
+)
 
 type RetryConfig struct {
-	Attempt int           `envconfig:"GORM_RETRY_ATTEMPT" required:"true"`
-	Delay   time.Duration `envconfig:"GORM_RETRY_DELAY" required:"true"`
+	Attempt  int           `envconfig:"GORM_RETRY_ATTEMPT" required:"true"`
+	Delay    time.Duration `envconfig:"GORM_RETRY_DELAY" required:"true"`
+	MaxDelay time.Duration `envconfig:"GORM_RETRY_MAX_DELAY"`
+	// Backoff defaults to an exponential backoff starting at Delay.
+	Backoff Backoff `ignored:"true"`
+	// Classifier defaults to NewDefaultClassifier with Attempt and Backoff.
+	Classifier ErrorClassifier `ignored:"true"`
+	// Rules are checked before the Classifier. Rules without Attempts or
+	// Backoff use the configured ones.
+	Rules   []RetryRule                                       `ignored:"true"`
+	OnRetry func(ctx context.Context, err error, attempt int) `ignored:"true"`
+}
+
+type RetryOption func(*RetryConfig)
+
+func WithAttempts(attempts int) RetryOption {
+	return func(c *RetryConfig) {
+		c.Attempt = attempts
+	}
+}
+
+func WithBackoff(backoff Backoff) RetryOption {
+	return func(c *RetryConfig) {
+		c.Backoff = backoff
+	}
+}
+
+func WithMaxDelay(maxDelay time.Duration) RetryOption {
+	return func(c *RetryConfig) {
+		c.MaxDelay = maxDelay
+	}
+}
+
+func WithClassifier(classifier ErrorClassifier) RetryOption {
+	return func(c *RetryConfig) {
+		c.Classifier = classifier
+	}
+}
+
+func WithRetryRules(rules ...RetryRule) RetryOption {
+	return func(c *RetryConfig) {
+		c.Rules = append(c.Rules, rules...)
+	}
+}
+
+// WithOnRetry sets a callback invoked before every retry, e.g. for metrics.
+func WithOnRetry(fn func(ctx context.Context, err error, attempt int)) RetryOption {
+	return func(c *RetryConfig) {
+		c.OnRetry = fn
+	}
+}
+
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		Attempt: defaultRetryAttempt,
+		Delay:   defaultRetryDelay,
+	}
+}
+
+// LoadRetryConfigFromEnv reads GORM_RETRY_ATTEMPT, GORM_RETRY_DELAY and
+// GORM_RETRY_MAX_DELAY, loading a .env file first when there is one.
+func LoadRetryConfigFromEnv() (RetryConfig, error) {
+	var config RetryConfig
+	_ = godotenv.Load()
+	err := envconfig.Process("", &config)
+	return config, err
+}
+
+// retryEnvSet tells whether any of the variables of RetryConfig is set.
+func retryEnvSet() bool {
+	for _, name := range []string{"GORM_RETRY_ATTEMPT", "GORM_RETRY_DELAY", "GORM_RETRY_MAX_DELAY"} {
+		if _, ok := os.LookupEnv(name); ok {
+			return true
+		}
+	}
+	return false
 }
 
 type PluginRetry interface {
@@ -29,14 +103,32 @@ type PluginRetry interface {
 
 type pluginRetry struct {
 	*gorm.DB
-	sqlDB         *sql.DB
-	ConnPool      *ConnPool
-	retryConfig   RetryConfig
-	retryMessages []retryMessage
+	sqlDB       *sql.DB
+	ConnPool    *ConnPool
+	retryConfig RetryConfig
+	classifier  ErrorClassifier
+	backoff     Backoff
+	configErr   error
 }
 
-func RegisterRetry() PluginRetry {
-	return pluginRetry{}
+// RegisterRetry creates the retry plugin configured from the environment,
+// falling back to DefaultRetryConfig when none of the variables is set. A
+// malformed or missing variable otherwise fails Initialize, so db.Use
+// reports it.
+func RegisterRetry(rules ...RetryRule) PluginRetry {
+	config, err := LoadRetryConfigFromEnv()
+	if err != nil && !retryEnvSet() {
+		config, err = DefaultRetryConfig(), nil
+	}
+	WithRetryRules(rules...)(&config)
+	return pluginRetry{retryConfig: config, configErr: err}
+}
+
+func RegisterRetryWithConfig(config RetryConfig, opts ...RetryOption) PluginRetry {
+	for _, opt := range opts {
+		opt(&config)
+	}
+	return pluginRetry{retryConfig: config}
 }
 
 func (s pluginRetry) Name() string {
@@ -44,26 +136,22 @@ func (s pluginRetry) Name() string {
 }
 
 func (s pluginRetry) Initialize(db *gorm.DB) error {
+	if s.configErr != nil {
+		return errors.Wrap(s.configErr, "invalid retry configuration")
+	}
 	s.DB = db
 	if err := s.registerSqlDB(db); err != nil {
 		return err
 	}
 	s.registerConnPool(db)
-	s.retryConfig = s.loadConfig()
-	s.retryMessages = s.getRetryConfig(s.retryConfig)
+	s.backoff = s.newBackoff(s.retryConfig)
+	s.classifier = s.newClassifier(s.retryConfig)
 	return nil
 }
 
-func (s pluginRetry) loadConfig() RetryConfig {
-	var config RetryConfig
-	_ = godotenv.Load()
-	envconfig.MustProcess("", &config)
-	return config
-}
-
 func (s *pluginRetry) registerConnPool(db *gorm.DB) {
 	basePool := db.ConnPool
-	if _, ok := basePool.(ConnPool); ok {
+	if _, ok := basePool.(*ConnPool); ok {
 		return
 	}
 	s.ConnPool = &ConnPool{ConnPool: basePool, pluginRetry: s}
@@ -80,29 +168,99 @@ func (s *pluginRetry) registerSqlDB(db *gorm.DB) error {
 	return nil
 }
 
-func (s pluginRetry) getRetryConfig(conf RetryConfig) []retryMessage {
-	var retryMessages []retryMessage
-	retryMessages = append(retryMessages, retryMessage{"connection reset by peer", conf.Attempt, conf.Delay})
-	retryMessages = append(retryMessages, retryMessage{"write: broken pipe", conf.Attempt, conf.Delay})
-	retryMessages = append(retryMessages, retryMessage{"connection refused", conf.Attempt, conf.Delay})
-	return retryMessages
+func (s pluginRetry) newBackoff(conf RetryConfig) Backoff {
+	backoff := conf.Backoff
+	if backoff == nil {
+		backoff = ExponentialBackoff(conf.Delay, conf.MaxDelay)
+	}
+	if conf.MaxDelay <= 0 {
+		return backoff
+	}
+	return func(attempt int) time.Duration {
+		if delay := backoff(attempt); delay < conf.MaxDelay {
+			return delay
+		}
+		return conf.MaxDelay
+	}
+}
+
+func (s pluginRetry) newClassifier(conf RetryConfig) ErrorClassifier {
+	rules := make([]RetryRule, len(conf.Rules))
+	for i, rule := range conf.Rules {
+		if rule.Attempts == 0 {
+			rule.Attempts = conf.Attempt
+		}
+		if rule.Backoff == nil {
+			rule.Backoff = s.backoff
+		}
+		rules[i] = rule
+	}
+	if conf.Classifier == nil {
+		return NewDefaultClassifier(conf.Attempt, s.backoff).Register(rules...)
+	}
+	if len(rules) == 0 {
+		return conf.Classifier
+	}
+	return classifierChain{NewClassifier(rules...), conf.Classifier}
 }
 
-func (s pluginRetry) retry(f func() error, err error) error {
+// retry runs f until it succeeds, the error is no longer retryable or the
+// attempts of its rule are exhausted. Waits between attempts stop as soon as
+// ctx is done.
+func (s pluginRetry) retry(ctx context.Context, f func() error, err error) error {
 	if err == nil {
 		return nil
 	}
-	for _, retryConf := range s.retryMessages {
-		if strings.Contains(err.Error(), retryConf.ErrMsgKey) {
-			for i := 0; i < retryConf.Retry; i++ {
-				err = f()
-				if err == nil {
-					return nil
-				}
-				logger.Error(errors.Wrap(err, "Retrying the execution"))
-				time.Sleep(retryConf.Delay)
-			}
+	rule, ok := s.classifier.Classify(err)
+	if !ok {
+		return err
+	}
+	backoff := rule.Backoff
+	if backoff == nil {
+		backoff = s.backoff
+	}
+	for i := 0; i < rule.Attempts; i++ {
+		if ctxErr := wait(ctx, backoff(i)); ctxErr != nil {
+			return ctxErr
+		}
+		if s.retryConfig.OnRetry != nil {
+			s.retryConfig.OnRetry(ctx, err, i+1)
+		}
+		err = f()
+		if err == nil {
+			return nil
+		}
+		logger.Error(errors.Wrapf(err, "Retrying the execution (%s)", rule.Name))
+		if _, ok := s.classifier.Classify(err); !ok {
+			return err
 		}
 	}
 	return err
 }
+
+func wait(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil || d <= 0 {
+		return err
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// classifierChain returns the classification of the first classifier that
+// recognises the error.
+type classifierChain []ErrorClassifier
+
+func (c classifierChain) Classify(err error) (RetryRule, bool) {
+	for _, classifier := range c {
+		if rule, ok := classifier.Classify(err); ok {
+			return rule, true
+		}
+	}
+	return RetryRule{}, false
+}
@@ -1,15 +1,20 @@
 package connection
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/DATA-DOG/go-sqlmock"
-	_ "github.com/lib/pq"
+	"github.com/best-expendables-v2/common-utils/transaction"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"os"
 	"testing"
+	"time"
 )
 
 type MainTestSuite struct {
@@ -35,7 +40,7 @@ func TestDbWithRetryTestSuite(s *testing.T) {
 	_ = os.Setenv("GORM_RETRY_ATTEMPT", "3")
 	_ = os.Setenv("GORM_RETRY_DELAY", "1s")
 	suite.Run(s, new(DbRetryWithoutTransactionTestSuite))
-	//suite.Run(s, new(DbRetryWithTransactionTestSuite))
+	suite.Run(s, new(DbRetryWithTransactionTestSuite))
 }
 
 func (s *MainTestSuite) SetupSuite() {
@@ -89,46 +94,183 @@ func (s *DbRetryWithoutTransactionTestSuite) TestDbRetryWithoutTransaction() {
 }
 
 func (s *DbRetryWithTransactionTestSuite) TestDbRetryWithTransaction() {
-	// Expect to retry 3 times: 2 failed and last 1 success
-	for i := 0; i <= defaultRetry; i++ {
-		if i != defaultRetry {
-			s.mock.ExpectExec("UPDATE products").
-				WillReturnError(fmt.Errorf("connection reset by peer [%d]", i))
-		} else {
-			s.mock.ExpectExec("UPDATE products").
-				WillReturnResult(sqlmock.NewResult(1, 1))
-		}
-	}
+	// The connection is lost in the middle of the first attempt: the statement
+	// must not be retried on its own, the whole transaction is replayed instead.
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec("UPDATE products").
+		WillReturnError(fmt.Errorf("connection reset by peer"))
+	s.mock.ExpectRollback()
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec("UPDATE products").WillReturnResult(sqlmock.NewResult(1, 1))
 	s.mock.ExpectExec("UPDATE product_viewers").WillReturnResult(sqlmock.NewResult(1, 1))
-	if err := recordStats(s.DB); err != nil {
+	s.mock.ExpectCommit()
+
+	attempts := 0
+	tnxManager := transaction.NewTxManager(s.DB, transaction.WithRetryBackoff(func(int) time.Duration { return 0 }))
+	err := tnxManager.RunInTx(context.Background(), func(ctx context.Context) error {
+		attempts++
+		return recordStats(transaction.GetTnx(ctx).(*gorm.DB))
+	})
+	if err != nil {
 		s.T().Errorf("error was not expected while updating stats: %s", err)
 	}
+	s.Equal(2, attempts)
 	if err := s.mock.ExpectationsWereMet(); err != nil {
 		s.T().Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
 
-func recordStats(db *gorm.DB) (err error) {
-	tx := db.Begin()
-	err = tx.Error
+func (s *DbRetryWithTransactionTestSuite) TestDbRetryWithTransactionNotRetryable() {
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec("UPDATE products").WillReturnError(fmt.Errorf("syntax error"))
+	s.mock.ExpectRollback()
+
+	attempts := 0
+	err := transaction.NewTxManager(s.DB).RunInTx(context.Background(), func(ctx context.Context) error {
+		attempts++
+		return recordStats(transaction.GetTnx(ctx).(*gorm.DB))
+	})
+	s.Error(err)
+	s.False(transaction.IsRetryable(err))
+	s.Equal(1, attempts)
+	if err := s.mock.ExpectationsWereMet(); err != nil {
+		s.T().Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func (s *DbRetryWithTransactionTestSuite) TestDbRetryWithTransactionCommitFailure() {
+	// A lost connection at commit may hide a committed transaction, only a
+	// serialization failure is replayed.
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec("UPDATE products").WillReturnResult(sqlmock.NewResult(1, 1))
+	s.mock.ExpectExec("UPDATE product_viewers").WillReturnResult(sqlmock.NewResult(1, 1))
+	s.mock.ExpectCommit().WillReturnError(&pq.Error{Code: "40001"})
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec("UPDATE products").WillReturnResult(sqlmock.NewResult(1, 1))
+	s.mock.ExpectExec("UPDATE product_viewers").WillReturnResult(sqlmock.NewResult(1, 1))
+	s.mock.ExpectCommit().WillReturnError(fmt.Errorf("connection reset by peer"))
+
+	attempts := 0
+	tnxManager := transaction.NewTxManager(s.DB, transaction.WithRetryBackoff(func(int) time.Duration { return 0 }))
+	err := tnxManager.RunInTx(context.Background(), func(ctx context.Context) error {
+		attempts++
+		return recordStats(transaction.GetTnx(ctx).(*gorm.DB))
+	})
+	s.Error(err)
+	s.False(transaction.IsRetryable(err))
+	s.Equal(2, attempts)
+	if err := s.mock.ExpectationsWereMet(); err != nil {
+		s.T().Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func recordStats(tx *gorm.DB) error {
+	if err := tx.Exec("UPDATE products SET views = views + 1").Error; err != nil {
+		return err
+	}
+	return tx.Exec("UPDATE product_viewers SET views = views + 1").Error
+}
+
+func TestRegisterRetryWithConfig(t *testing.T) {
+	rawDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open mock sql db, got error: %v", err)
+	}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: rawDB}), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var retries []int
+	err = db.Use(RegisterRetryWithConfig(RetryConfig{},
+		WithAttempts(2),
+		WithBackoff(ExponentialBackoff(time.Millisecond, 0)),
+		WithMaxDelay(5*time.Millisecond),
+		WithRetryRules(RetryRule{Name: "custom", Match: MatchMessages("custom failure")}),
+		WithOnRetry(func(ctx context.Context, err error, attempt int) {
+			retries = append(retries, attempt)
+		}),
+	))
 	if err != nil {
-		return
+		t.Fatalf("Cannot register plugin: %v", err)
 	}
 
-	defer func() {
-		switch err {
-		case nil:
-			err = tx.Commit().Error
-		default:
-			tx.Rollback()
-		}
-	}()
+	mock.ExpectExec("UPDATE products").WillReturnError(errors.New("custom failure"))
+	mock.ExpectExec("UPDATE products").WillReturnError(errors.New("custom failure"))
+	mock.ExpectExec("UPDATE products").WillReturnResult(sqlmock.NewResult(1, 1))
+	if err := db.Exec("UPDATE products SET views = views + 1").Error; err != nil {
+		t.Errorf("Expect no error return but got error: %s", err)
+	}
+	assert.Equal(t, []int{1, 2}, retries)
+
+	mock.ExpectExec("UPDATE products").WillReturnError(errors.New("syntax error"))
+	assert.Error(t, db.Exec("UPDATE products SET views = views + 1").Error)
+	assert.Equal(t, []int{1, 2}, retries)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRegisterRetryMalformedEnv(t *testing.T) {
+	t.Setenv("GORM_RETRY_ATTEMPT", "three")
+	t.Setenv("GORM_RETRY_DELAY", "1s")
+	rawDB, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open mock sql db, got error: %v", err)
+	}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: rawDB}), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Use(RegisterRetry())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "GORM_RETRY_ATTEMPT")
+}
+
+func TestRegisterConnPoolOnce(t *testing.T) {
+	db, _ := openRetryMockDB(t)
+	pool, ok := db.ConnPool.(*ConnPool)
+	assert.True(t, ok)
 
-	if err = tx.Exec("UPDATE products SET views = views + 1").Error; err != nil {
-		return
+	(&pluginRetry{}).registerConnPool(db)
+	assert.Same(t, pool, db.ConnPool)
+}
+
+func TestRetryStopsWhenContextIsDone(t *testing.T) {
+	db, mock := openRetryMockDB(t, WithAttempts(5), WithBackoff(ConstantBackoff(time.Hour)))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	mock.ExpectExec("UPDATE products").WillReturnError(errors.New("connection refused"))
+	start := time.Now()
+	err := db.WithContext(ctx).Exec("UPDATE products SET views = views + 1").Error
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRetryQueryRow(t *testing.T) {
+	db, mock := openRetryMockDB(t, WithAttempts(2), WithBackoff(ConstantBackoff(time.Millisecond)))
+
+	mock.ExpectQuery("SELECT count").WillReturnError(errors.New("write: broken pipe"))
+	mock.ExpectQuery("SELECT count").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(7))
+	var count int
+	assert.NoError(t, db.Raw("SELECT count(*) FROM products").Row().Scan(&count))
+	assert.Equal(t, 7, count)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func openRetryMockDB(t *testing.T, opts ...RetryOption) (*gorm.DB, sqlmock.Sqlmock) {
+	rawDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open mock sql db, got error: %v", err)
+	}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: rawDB}), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
 	}
-	if err = tx.Exec("UPDATE product_viewers SET views = views + 1").Error; err != nil {
-		return
+	if err := db.Use(RegisterRetryWithConfig(DefaultRetryConfig(), opts...)); err != nil {
+		t.Fatalf("Cannot register plugin: %v", err)
 	}
-	return
+	return db, mock
 }
@@ -0,0 +1,128 @@
+package connection
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const statementCancelKey = "statement_timeout:cancel"
+
+type pluginStatementTimeout struct {
+	defaultTimeout time.Duration
+}
+
+// RegisterStatementTimeout creates a plugin bounding every statement by the
+// deadline of its context, or by defaultTimeout when there is none. Inside a
+// Postgres transaction the bound is applied with SET LOCAL statement_timeout,
+// MySQL and MariaDB SELECTs get a MAX_EXECUTION_TIME hint, and everything
+// else runs with a context timeout so the driver cancels the query.
+func RegisterStatementTimeout(defaultTimeout time.Duration) gorm.Plugin {
+	return pluginStatementTimeout{defaultTimeout: defaultTimeout}
+}
+
+func (p pluginStatementTimeout) Name() string {
+	return "gorm:statement_timeout"
+}
+
+func (p pluginStatementTimeout) Initialize(db *gorm.DB) error {
+	callback := db.Callback()
+	errs := []error{
+		callback.Create().Before("gorm:before_create").Register("statement_timeout:before_create", p.before("create")),
+		callback.Create().After("gorm:after_create").Register("statement_timeout:after_create", p.after),
+		callback.Query().Before("gorm:query").Register("statement_timeout:before_query", p.before("query")),
+		callback.Query().After("gorm:after_query").Register("statement_timeout:after_query", p.after),
+		callback.Update().Before("gorm:before_update").Register("statement_timeout:before_update", p.before("update")),
+		callback.Update().After("gorm:after_update").Register("statement_timeout:after_update", p.after),
+		callback.Delete().Before("gorm:before_delete").Register("statement_timeout:before_delete", p.before("delete")),
+		callback.Delete().After("gorm:after_delete").Register("statement_timeout:after_delete", p.after),
+		callback.Row().Before("gorm:row").Register("statement_timeout:before_row", p.before("row")),
+		callback.Raw().Before("gorm:raw").Register("statement_timeout:before_raw", p.before("raw")),
+		callback.Raw().After("gorm:raw").Register("statement_timeout:after_raw", p.after),
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p pluginStatementTimeout) timeout(ctx context.Context) (time.Duration, bool) {
+	if deadline, ok := ctx.Deadline(); ok {
+		return time.Until(deadline), true
+	}
+	return p.defaultTimeout, p.defaultTimeout > 0
+}
+
+func (p pluginStatementTimeout) before(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Error != nil {
+			return
+		}
+		ctx := db.Statement.Context
+		timeout, ok := p.timeout(ctx)
+		if !ok || timeout <= 0 {
+			return
+		}
+		switch db.Dialector.Name() {
+		case "postgres":
+			if inTransaction(db.Statement.ConnPool) {
+				query := fmt.Sprintf("SET LOCAL statement_timeout = %d", milliseconds(timeout))
+				if _, err := db.Statement.ConnPool.ExecContext(ctx, query); err != nil {
+					_ = db.AddError(err)
+				}
+				return
+			}
+		case "mysql":
+			if operation == "query" {
+				setMaxExecutionTime(db.Statement, timeout)
+			}
+		}
+		// Rows and Row are read after the callbacks, cancelling their context
+		// here would close them.
+		if _, ok := ctx.Deadline(); ok || operation == "row" {
+			return
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		db.Statement.Context = ctx
+		db.InstanceSet(statementCancelKey, cancel)
+	}
+}
+
+func (p pluginStatementTimeout) after(db *gorm.DB) {
+	if cancel, ok := db.InstanceGet(statementCancelKey); ok {
+		cancel.(context.CancelFunc)()
+	}
+}
+
+func setMaxExecutionTime(stmt *gorm.Statement, timeout time.Duration) {
+	c := stmt.Clauses["SELECT"]
+	c.AfterNameExpression = clause.Expr{SQL: fmt.Sprintf("/*+ MAX_EXECUTION_TIME(%d) */", milliseconds(timeout))}
+	stmt.Clauses["SELECT"] = c
+}
+
+// milliseconds rounds up, a zero timeout disables the server side limit.
+func milliseconds(d time.Duration) int64 {
+	ms := int64((d + time.Millisecond - 1) / time.Millisecond)
+	if ms < 1 {
+		return 1
+	}
+	return ms
+}
+
+// inTransaction tells whether statements run on pool share a transaction.
+// The retry ConnPool implements Commit without being one.
+func inTransaction(pool gorm.ConnPool) bool {
+	switch pool.(type) {
+	case *TxConnPool:
+		return true
+	case *ConnPool:
+		return false
+	}
+	_, ok := pool.(gorm.TxCommitter)
+	return ok
+}
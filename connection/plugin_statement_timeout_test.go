@@ -0,0 +1,78 @@
+package connection
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type timeoutProduct struct {
+	ID   string
+	Name string
+}
+
+func openTimeoutMockDB(t *testing.T, dialector func(conn gorm.ConnPool) gorm.Dialector, defaultTimeout time.Duration) (*gorm.DB, sqlmock.Sqlmock) {
+	rawDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open mock sql db, got error: %v", err)
+	}
+	db, err := gorm.Open(dialector(rawDB), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(RegisterStatementTimeout(defaultTimeout)); err != nil {
+		t.Fatalf("Cannot register plugin: %v", err)
+	}
+	return db, mock
+}
+
+func postgresDialector(conn gorm.ConnPool) gorm.Dialector {
+	return postgres.New(postgres.Config{Conn: conn})
+}
+
+func mysqlDialector(conn gorm.ConnPool) gorm.Dialector {
+	return mysql.New(mysql.Config{Conn: conn, SkipInitializeWithVersion: true})
+}
+
+func TestStatementTimeout_PostgresTransaction(t *testing.T) {
+	db, mock := openTimeoutMockDB(t, postgresDialector, 1500*time.Millisecond)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SET LOCAL statement_timeout = 1500`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO "timeout_products"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, db.Create(&timeoutProduct{ID: "1", Name: "a"}).Error)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStatementTimeout_CancelsQuery(t *testing.T) {
+	db, mock := openTimeoutMockDB(t, postgresDialector, 10*time.Millisecond)
+
+	mock.ExpectQuery(`SELECT`).WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+
+	var products []timeoutProduct
+	err := db.Find(&products).Error
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "canceling query")
+}
+
+func TestStatementTimeout_MySQLHint(t *testing.T) {
+	db, mock := openTimeoutMockDB(t, mysqlDialector, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	mock.ExpectQuery(`SELECT /\*\+ MAX_EXECUTION_TIME\(\d+\) \*/ \* FROM .timeout_products.`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+
+	var products []timeoutProduct
+	assert.NoError(t, db.WithContext(ctx).Find(&products).Error)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,88 @@
+package connection
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// QueryMetrics receives the measurements of the query log plugin.
+// Implementations must be safe for concurrent use.
+type QueryMetrics interface {
+	ObserveQuery(table, operation string, d time.Duration, rowsAffected int64, err error)
+}
+
+type noopQueryMetrics struct{}
+
+func (noopQueryMetrics) ObserveQuery(string, string, time.Duration, int64, error) {}
+
+type QuerySeries struct {
+	Table         string        `json:"table"`
+	Operation     string        `json:"operation"`
+	Count         int64         `json:"count"`
+	Errors        int64         `json:"errors"`
+	RowsAffected  int64         `json:"rowsAffected"`
+	TotalDuration time.Duration `json:"totalDuration"`
+	MaxDuration   time.Duration `json:"maxDuration"`
+}
+
+func (s QuerySeries) AvgDuration() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.TotalDuration / time.Duration(s.Count)
+}
+
+type querySeriesKey struct {
+	table     string
+	operation string
+}
+
+// QueryStats is an in-memory QueryMetrics implementation.
+type QueryStats struct {
+	mu     sync.Mutex
+	series map[querySeriesKey]*QuerySeries
+}
+
+func NewQueryStats() *QueryStats {
+	return &QueryStats{series: map[querySeriesKey]*QuerySeries{}}
+}
+
+func (s *QueryStats) ObserveQuery(table, operation string, d time.Duration, rowsAffected int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := querySeriesKey{table: table, operation: operation}
+	series, ok := s.series[key]
+	if !ok {
+		series = &QuerySeries{Table: table, Operation: operation}
+		s.series[key] = series
+	}
+	series.Count++
+	if err != nil {
+		series.Errors++
+	}
+	if rowsAffected > 0 {
+		series.RowsAffected += rowsAffected
+	}
+	series.TotalDuration += d
+	if d > series.MaxDuration {
+		series.MaxDuration = d
+	}
+}
+
+// Snapshot returns a copy of every series sorted by table and operation.
+func (s *QueryStats) Snapshot() []QuerySeries {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]QuerySeries, 0, len(s.series))
+	for _, series := range s.series {
+		result = append(result, *series)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Table != result[j].Table {
+			return result[i].Table < result[j].Table
+		}
+		return result[i].Operation < result[j].Operation
+	})
+	return result
+}
@@ -0,0 +1,72 @@
+package connection
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrReplicationNotRunning = errors.New("replication is not running")
+
+const postgresReplicationLagQuery = `SELECT CASE
+	WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+END`
+
+// ReplicationLag returns how far behind its primary db is. A primary reports no lag.
+func ReplicationLag(ctx context.Context, db *gorm.DB) (time.Duration, error) {
+	switch db.Dialector.Name() {
+	case "postgres":
+		var seconds float64
+		if err := db.WithContext(ctx).Raw(postgresReplicationLagQuery).Row().Scan(&seconds); err != nil {
+			return 0, err
+		}
+		return time.Duration(seconds * float64(time.Second)), nil
+	case "mysql":
+		return mysqlReplicationLag(ctx, db)
+	}
+	return 0, fmt.Errorf("replication lag is not supported for %s", db.Dialector.Name())
+}
+
+func mysqlReplicationLag(ctx context.Context, db *gorm.DB) (time.Duration, error) {
+	rows, err := db.WithContext(ctx).Raw("SHOW SLAVE STATUS").Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		// Not a replica.
+		return 0, rows.Err()
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return 0, err
+	}
+	for i, column := range columns {
+		if column != "Seconds_Behind_Master" {
+			continue
+		}
+		if values[i] == nil {
+			return 0, ErrReplicationNotRunning
+		}
+		seconds, err := strconv.ParseInt(string(values[i]), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return 0, ErrReplicationNotRunning
+}
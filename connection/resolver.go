@@ -0,0 +1,210 @@
+package connection
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/best-expendables-v2/common-utils/transaction"
+	"gorm.io/gorm"
+)
+
+type contextKey string
+
+var forcePrimaryKey contextKey = "forcePrimary"
+
+// ForcePrimary makes every read done with ctx go to the primary, e.g. to
+// read your own writes right after a change.
+func ForcePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forcePrimaryKey, true)
+}
+
+func IsPrimaryForced(ctx context.Context) bool {
+	v, _ := ctx.Value(forcePrimaryKey).(bool)
+	return v
+}
+
+// DBResolver picks the database used for writes and for reads.
+type DBResolver interface {
+	Writer(ctx context.Context) *gorm.DB
+	Reader(ctx context.Context) *gorm.DB
+}
+
+var _ DBResolver = (*Resolver)(nil)
+
+type ReplicaPolicy int
+
+const (
+	RandomReplica ReplicaPolicy = iota
+	LeastLatencyReplica
+)
+
+const defaultHealthCheckTimeout = 2 * time.Second
+
+type replica struct {
+	db      *gorm.DB
+	healthy int32
+	latency int64
+}
+
+func (r *replica) isHealthy() bool {
+	return atomic.LoadInt32(&r.healthy) == 1
+}
+
+// Resolver sends writes to the primary and reads to healthy replicas.
+// Reads fall back to the primary when ctx carries a transaction, when
+// ForcePrimary was used or when no replica is healthy.
+type Resolver struct {
+	primary      *gorm.DB
+	replicas     []*replica
+	policy       ReplicaPolicy
+	maxLag       time.Duration
+	lagFunc      func(ctx context.Context, db *gorm.DB) (time.Duration, error)
+	checkTimeout time.Duration
+	stopOnce     sync.Once
+	stop         chan struct{}
+}
+
+type ResolverOption func(*Resolver)
+
+func WithReplicaPolicy(policy ReplicaPolicy) ResolverOption {
+	return func(r *Resolver) {
+		r.policy = policy
+	}
+}
+
+// WithMaxReplicationLag ejects replicas lagging more than maxLag behind the
+// primary until a later health check sees them caught up.
+func WithMaxReplicationLag(maxLag time.Duration) ResolverOption {
+	return func(r *Resolver) {
+		r.maxLag = maxLag
+	}
+}
+
+// WithReplicationLagFunc replaces ReplicationLag, e.g. for a heartbeat table.
+func WithReplicationLagFunc(fn func(ctx context.Context, db *gorm.DB) (time.Duration, error)) ResolverOption {
+	return func(r *Resolver) {
+		r.lagFunc = fn
+	}
+}
+
+func WithHealthCheckTimeout(timeout time.Duration) ResolverOption {
+	return func(r *Resolver) {
+		r.checkTimeout = timeout
+	}
+}
+
+func NewResolver(primary *gorm.DB, replicas []*gorm.DB, opts ...ResolverOption) *Resolver {
+	r := &Resolver{
+		primary:      primary,
+		lagFunc:      ReplicationLag,
+		checkTimeout: defaultHealthCheckTimeout,
+		stop:         make(chan struct{}),
+	}
+	for _, db := range replicas {
+		r.replicas = append(r.replicas, &replica{db: db, healthy: 1})
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+func (r *Resolver) Writer(ctx context.Context) *gorm.DB {
+	return r.primary
+}
+
+func (r *Resolver) Reader(ctx context.Context) *gorm.DB {
+	if transaction.GetTnx(ctx) != nil || IsPrimaryForced(ctx) {
+		return r.primary
+	}
+	if picked := r.pickReplica(); picked != nil {
+		return picked.db
+	}
+	return r.primary
+}
+
+func (r *Resolver) pickReplica() *replica {
+	var healthy []*replica
+	for _, candidate := range r.replicas {
+		if candidate.isHealthy() {
+			healthy = append(healthy, candidate)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+	if r.policy == LeastLatencyReplica {
+		best := healthy[0]
+		for _, candidate := range healthy[1:] {
+			if atomic.LoadInt64(&candidate.latency) < atomic.LoadInt64(&best.latency) {
+				best = candidate
+			}
+		}
+		return best
+	}
+	return healthy[rand.Intn(len(healthy))]
+}
+
+// CheckReplicas pings every replica and measures its replication lag,
+// ejecting the unreachable and lagging ones.
+func (r *Resolver) CheckReplicas(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, rep := range r.replicas {
+		wg.Add(1)
+		go func(rep *replica) {
+			defer wg.Done()
+			r.checkReplica(ctx, rep)
+		}(rep)
+	}
+	wg.Wait()
+}
+
+func (r *Resolver) checkReplica(ctx context.Context, rep *replica) {
+	ctx, cancel := context.WithTimeout(ctx, r.checkTimeout)
+	defer cancel()
+
+	healthy := int32(1)
+	start := time.Now()
+	sqlDB, err := rep.db.DB()
+	if err == nil {
+		err = sqlDB.PingContext(ctx)
+	}
+	atomic.StoreInt64(&rep.latency, int64(time.Since(start)))
+	if err == nil && r.maxLag > 0 {
+		var lag time.Duration
+		lag, err = r.lagFunc(ctx, rep.db)
+		if err == nil && lag > r.maxLag {
+			healthy = 0
+		}
+	}
+	if err != nil {
+		healthy = 0
+	}
+	atomic.StoreInt32(&rep.healthy, healthy)
+}
+
+// StartHealthCheck runs CheckReplicas every interval until Close is called.
+func (r *Resolver) StartHealthCheck(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				r.CheckReplicas(context.Background())
+			}
+		}
+	}()
+}
+
+// Close stops the health checks, it does not close the databases.
+func (r *Resolver) Close() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+}
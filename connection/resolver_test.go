@@ -0,0 +1,79 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/best-expendables-v2/common-utils/transaction"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func openResolverMockDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	rawDB, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("Failed to open mock sql db, got error: %v", err)
+	}
+	mock.ExpectPing()
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: rawDB}), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, mock
+}
+
+func TestResolverReader(t *testing.T) {
+	primary, primaryMock := openResolverMockDB(t)
+	replica, _ := openResolverMockDB(t)
+	resolver := NewResolver(primary, []*gorm.DB{replica})
+	primaryMock.ExpectBegin()
+
+	ctx := context.Background()
+	assert.Equal(t, primary, resolver.Writer(ctx))
+	assert.Equal(t, replica, resolver.Reader(ctx))
+	assert.Equal(t, primary, resolver.Reader(ForcePrimary(ctx)))
+
+	_, txCtx := transaction.NewTxManager(primary).Start(ctx)
+	assert.NotEqual(t, replica, resolver.Reader(txCtx))
+	assert.Equal(t, primary, resolver.Reader(txCtx))
+}
+
+func TestResolverEjectsUnhealthyReplicas(t *testing.T) {
+	primary, _ := openResolverMockDB(t)
+	lagging, laggingMock := openResolverMockDB(t)
+	down, downMock := openResolverMockDB(t)
+	lags := map[*gorm.DB]time.Duration{lagging: time.Minute}
+	resolver := NewResolver(primary, []*gorm.DB{lagging, down},
+		WithMaxReplicationLag(time.Second),
+		WithReplicationLagFunc(func(ctx context.Context, db *gorm.DB) (time.Duration, error) {
+			return lags[db], nil
+		}),
+	)
+
+	laggingMock.ExpectPing()
+	downMock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	resolver.CheckReplicas(context.Background())
+	assert.Equal(t, primary, resolver.Reader(context.Background()))
+
+	lags[lagging] = 0
+	laggingMock.ExpectPing()
+	downMock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	resolver.CheckReplicas(context.Background())
+	assert.Equal(t, lagging, resolver.Reader(context.Background()))
+	assert.NoError(t, laggingMock.ExpectationsWereMet())
+	assert.NoError(t, downMock.ExpectationsWereMet())
+}
+
+func TestReplicationLag(t *testing.T) {
+	db, mock := openResolverMockDB(t)
+	mock.ExpectQuery("pg_last_xact_replay_timestamp").
+		WillReturnRows(sqlmock.NewRows([]string{"lag"}).AddRow(1.5))
+
+	lag, err := ReplicationLag(context.Background(), db)
+	assert.NoError(t, err)
+	assert.Equal(t, 1500*time.Millisecond, lag)
+}
@@ -0,0 +1,472 @@
+package connection
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/best-expendables-v2/common-utils/tenant"
+	"github.com/pkg/errors"
+	gormmysql "gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultMaxTenantPools     = 50
+	defaultTenantCloseTimeout = 30 * time.Second
+)
+
+var (
+	ErrTenantRequired = errors.New("no tenant in context")
+	ErrInvalidTenant  = errors.New("invalid tenant id")
+)
+
+var _ DBResolver = (*TenantRouter)(nil)
+
+var schemaNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// TenantConfigFunc returns the database configuration of a tenant.
+type TenantConfigFunc func(ctx context.Context, tenantID string) (Config, error)
+
+// SchemaPerTenant keeps every tenant in its own Postgres schema of the base
+// database. Each tenant gets a pool whose connections have the schema as
+// search_path, so it cannot leak between tenants through pooled connections.
+func SchemaPerTenant(base Config, schemaOf func(tenantID string) string) TenantConfigFunc {
+	return func(ctx context.Context, tenantID string) (Config, error) {
+		schema := tenantID
+		if schemaOf != nil {
+			schema = schemaOf(tenantID)
+		}
+		if !schemaNamePattern.MatchString(schema) {
+			return Config{}, errors.Wrap(ErrInvalidTenant, tenantID)
+		}
+		config := base
+		config.Params = map[string]string{}
+		for k, v := range base.Params {
+			config.Params[k] = v
+		}
+		config.Params["search_path"] = schema
+		return config, nil
+	}
+}
+
+// DatabasePerTenant gives every tenant its own database, described by configOf.
+func DatabasePerTenant(configOf TenantConfigFunc) TenantConfigFunc {
+	return configOf
+}
+
+type tenantPool struct {
+	tenantID string
+	ready    chan struct{}
+	db       *DB
+	session  *gorm.DB
+	err      error
+	// refs counts the statements running and the transactions open on the
+	// pool, an evicted pool is closed once it drops to zero. Both are
+	// guarded by TenantRouter.mu.
+	refs    int
+	evicted bool
+}
+
+// TenantRouter routes every query to the database of the tenant carried by
+// the context. Pools are opened on first use and the least recently used one
+// is evicted once more than the maximum are open. The databases handed out
+// look the pool of their tenant up on every statement and transaction, an
+// evicted pool is only closed once none of them runs on it.
+type TenantRouter struct {
+	configOf     TenantConfigFunc
+	fallback     *gorm.DB
+	dialect      string
+	maxPools     int
+	closeTimeout time.Duration
+	open         func(ctx context.Context, config Config) (*DB, error)
+
+	mu    sync.Mutex
+	pools map[string]*list.Element
+	lru   *list.List
+
+	failedOnce sync.Once
+	failed     *gorm.DB
+}
+
+type TenantRouterOption func(*TenantRouter)
+
+// WithFallbackDB is used for contexts without a tenant, which otherwise fail
+// with ErrTenantRequired.
+func WithFallbackDB(db *gorm.DB) TenantRouterOption {
+	return func(r *TenantRouter) {
+		r.fallback = db
+	}
+}
+
+// WithTenantDialect tells the dialect of the tenant databases, Postgres by
+// default, used by the sessions reporting routing errors.
+func WithTenantDialect(dialect string) TenantRouterOption {
+	return func(r *TenantRouter) {
+		r.dialect = dialect
+	}
+}
+
+func WithMaxTenantPools(max int) TenantRouterOption {
+	return func(r *TenantRouter) {
+		r.maxPools = max
+	}
+}
+
+// WithTenantCloseTimeout bounds how long an evicted pool waits for its
+// in-flight queries.
+func WithTenantCloseTimeout(timeout time.Duration) TenantRouterOption {
+	return func(r *TenantRouter) {
+		r.closeTimeout = timeout
+	}
+}
+
+func NewTenantRouter(configOf TenantConfigFunc, opts ...TenantRouterOption) *TenantRouter {
+	r := &TenantRouter{
+		configOf:     configOf,
+		dialect:      Postgres,
+		maxPools:     defaultMaxTenantPools,
+		closeTimeout: defaultTenantCloseTimeout,
+		open:         Open,
+		pools:        map[string]*list.Element{},
+		lru:          list.New(),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// DB returns the database of the tenant carried by ctx, opening it if needed.
+func (r *TenantRouter) DB(ctx context.Context) (*gorm.DB, error) {
+	tenantID := tenant.GetTenantIDFromContext(ctx)
+	if tenantID == "" {
+		if r.fallback != nil {
+			return r.fallback, nil
+		}
+		return nil, ErrTenantRequired
+	}
+	pool, err := r.acquire(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	r.release(pool)
+	return pool.session, nil
+}
+
+// acquire returns the open pool of tenantID, the caller must release it.
+func (r *TenantRouter) acquire(ctx context.Context, tenantID string) (*tenantPool, error) {
+	pool := r.pool(ctx, tenantID)
+	select {
+	case <-pool.ready:
+	case <-ctx.Done():
+		r.release(pool)
+		return nil, ctx.Err()
+	}
+	if pool.err != nil {
+		r.release(pool)
+		return nil, pool.err
+	}
+	return pool, nil
+}
+
+// Writer returns the tenant database. Failures are reported by the first
+// statement run on the returned session.
+func (r *TenantRouter) Writer(ctx context.Context) *gorm.DB {
+	db, err := r.DB(ctx)
+	if err == nil {
+		return db
+	}
+	if db = r.fallback; db == nil {
+		db = r.failedDB()
+	}
+	return withConnPool(db, failedConnPool{err: errors.Wrap(err, "tenant database")})
+}
+
+// failedDB carries routing errors when there is no fallback database, none
+// of its statements reach a connection.
+func (r *TenantRouter) failedDB() *gorm.DB {
+	r.failedOnce.Do(func() {
+		conn := failedConnPool{err: ErrTenantRequired}
+		var dialector gorm.Dialector = postgres.New(postgres.Config{Conn: conn})
+		if r.dialect == MySQL || r.dialect == MariaDB {
+			dialector = gormmysql.New(gormmysql.Config{Conn: conn, SkipInitializeWithVersion: true})
+		}
+		r.failed, _ = gorm.Open(dialector, &gorm.Config{DisableAutomaticPing: true})
+	})
+	return r.failed
+}
+
+// withConnPool returns a session of db running its statements on pool.
+func withConnPool(db *gorm.DB, pool gorm.ConnPool) *gorm.DB {
+	// A context clones the statement, which the session must not share.
+	session := db.Session(&gorm.Session{NewDB: true, Context: context.Background()})
+	session.ConnPool = pool
+	session.Statement.ConnPool = pool
+	return session
+}
+
+// tenantConnPool runs every statement and transaction on the current pool
+// of its tenant, holding a reference on it until they are done.
+type tenantConnPool struct {
+	router   *TenantRouter
+	tenantID string
+}
+
+func (p tenantConnPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	pool, err := p.router.acquire(ctx, p.tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer p.router.release(pool)
+	return pool.db.DB.ConnPool.PrepareContext(ctx, query)
+}
+
+func (p tenantConnPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	pool, err := p.router.acquire(ctx, p.tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer p.router.release(pool)
+	return pool.db.DB.ConnPool.ExecContext(ctx, query, args...)
+}
+
+// QueryContext releases the pool once the query ran, closing the pool lets
+// the rows already read from finish.
+func (p tenantConnPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	pool, err := p.router.acquire(ctx, p.tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer p.router.release(pool)
+	return pool.db.DB.ConnPool.QueryContext(ctx, query, args...)
+}
+
+func (p tenantConnPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	pool, err := p.router.acquire(ctx, p.tenantID)
+	if err != nil {
+		return errorRow(ctx, err)
+	}
+	defer p.router.release(pool)
+	return pool.db.DB.ConnPool.QueryRowContext(ctx, query, args...)
+}
+
+// BeginTx holds the pool until the transaction commits or rolls back.
+func (p tenantConnPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	pool, err := p.router.acquire(ctx, p.tenantID)
+	if err != nil {
+		return nil, err
+	}
+	var tx gorm.ConnPool
+	switch beginner := pool.db.DB.ConnPool.(type) {
+	case gorm.ConnPoolBeginner:
+		tx, err = beginner.BeginTx(ctx, opts)
+	case gorm.TxBeginner:
+		var sqlTx *sql.Tx
+		if sqlTx, err = beginner.BeginTx(ctx, opts); err == nil {
+			tx = sqlTx
+		}
+	default:
+		err = gorm.ErrInvalidTransaction
+	}
+	if err != nil {
+		p.router.release(pool)
+		return nil, err
+	}
+	return &tenantTx{ConnPool: tx, release: func() { p.router.release(pool) }}, nil
+}
+
+func (p tenantConnPool) GetDBConn() (*sql.DB, error) {
+	pool, err := p.router.acquire(context.Background(), p.tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer p.router.release(pool)
+	return pool.db.DB.DB()
+}
+
+type tenantTx struct {
+	gorm.ConnPool
+	release func()
+	once    sync.Once
+}
+
+func (t *tenantTx) Commit() error {
+	defer t.once.Do(t.release)
+	return t.ConnPool.(gorm.TxCommitter).Commit()
+}
+
+func (t *tenantTx) Rollback() error {
+	defer t.once.Do(t.release)
+	return t.ConnPool.(gorm.TxCommitter).Rollback()
+}
+
+// failedConnPool fails every statement with err.
+type failedConnPool struct {
+	err error
+}
+
+func (p failedConnPool) PrepareContext(context.Context, string) (*sql.Stmt, error) {
+	return nil, p.err
+}
+
+func (p failedConnPool) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, p.err
+}
+
+func (p failedConnPool) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	return nil, p.err
+}
+
+func (p failedConnPool) QueryRowContext(ctx context.Context, _ string, _ ...interface{}) *sql.Row {
+	return errorRow(ctx, p.err)
+}
+
+func (p failedConnPool) BeginTx(context.Context, *sql.TxOptions) (gorm.ConnPool, error) {
+	return nil, p.err
+}
+
+// errorRow returns a row whose Scan fails with err, sql.Row has no other
+// way to carry one.
+func errorRow(ctx context.Context, err error) *sql.Row {
+	db := sql.OpenDB(failedConnector{err: err})
+	defer db.Close()
+	return db.QueryRowContext(ctx, "")
+}
+
+type failedConnector struct {
+	err error
+}
+
+func (c failedConnector) Connect(context.Context) (driver.Conn, error) {
+	return nil, c.err
+}
+
+func (c failedConnector) Open(string) (driver.Conn, error) {
+	return nil, c.err
+}
+
+func (c failedConnector) Driver() driver.Driver {
+	return c
+}
+
+func (r *TenantRouter) Reader(ctx context.Context) *gorm.DB {
+	return r.Writer(ctx)
+}
+
+// pool returns the pool of tenantID with a reference the caller must release.
+func (r *TenantRouter) pool(ctx context.Context, tenantID string) *tenantPool {
+	r.mu.Lock()
+	if el, ok := r.pools[tenantID]; ok {
+		r.lru.MoveToFront(el)
+		pool := el.Value.(*tenantPool)
+		pool.refs++
+		r.mu.Unlock()
+		return pool
+	}
+	pool := &tenantPool{tenantID: tenantID, ready: make(chan struct{}), refs: 1}
+	r.pools[tenantID] = r.lru.PushFront(pool)
+	r.mu.Unlock()
+
+	// Opening is not bound to the caller, other requests may wait on it.
+	go r.load(context.Background(), pool)
+	return pool
+}
+
+func (r *TenantRouter) load(ctx context.Context, pool *tenantPool) {
+	defer close(pool.ready)
+	config, err := r.configOf(ctx, pool.tenantID)
+	if err == nil {
+		pool.db, err = r.open(ctx, config)
+	}
+	if err == nil {
+		pool.session = withConnPool(pool.db.DB, tenantConnPool{router: r, tenantID: pool.tenantID})
+	}
+	pool.err = err
+
+	r.mu.Lock()
+	var unused []*tenantPool
+	if err != nil {
+		if el, ok := r.pools[pool.tenantID]; ok && el.Value == pool {
+			r.lru.Remove(el)
+			delete(r.pools, pool.tenantID)
+		}
+	} else {
+		// Only evict for pools that opened, a failing tenant must not close
+		// the healthy ones.
+		for _, old := range r.evict() {
+			old.evicted = true
+			if old.refs == 0 {
+				unused = append(unused, old)
+			}
+		}
+	}
+	r.mu.Unlock()
+	for _, old := range unused {
+		go r.close(old)
+	}
+}
+
+// release drops a reference on pool, closing it when it was the last one of
+// an evicted pool.
+func (r *TenantRouter) release(pool *tenantPool) {
+	r.mu.Lock()
+	pool.refs--
+	unused := pool.evicted && pool.refs == 0
+	r.mu.Unlock()
+	if unused {
+		go r.close(pool)
+	}
+}
+
+// evict must be called with mu held.
+func (r *TenantRouter) evict() []*tenantPool {
+	var evicted []*tenantPool
+	for r.maxPools > 0 && r.lru.Len() > r.maxPools {
+		el := r.lru.Back()
+		pool := el.Value.(*tenantPool)
+		r.lru.Remove(el)
+		delete(r.pools, pool.tenantID)
+		evicted = append(evicted, pool)
+	}
+	return evicted
+}
+
+func (r *TenantRouter) close(pool *tenantPool) {
+	<-pool.ready
+	if pool.db == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), r.closeTimeout)
+	defer cancel()
+	_ = pool.db.Close(ctx)
+}
+
+// Close closes every open tenant pool.
+func (r *TenantRouter) Close(ctx context.Context) error {
+	r.mu.Lock()
+	pools := make([]*tenantPool, 0, r.lru.Len())
+	for el := r.lru.Front(); el != nil; el = el.Next() {
+		pools = append(pools, el.Value.(*tenantPool))
+	}
+	r.pools = map[string]*list.Element{}
+	r.lru.Init()
+	r.mu.Unlock()
+
+	var result error
+	for _, pool := range pools {
+		<-pool.ready
+		if pool.db == nil {
+			continue
+		}
+		if err := pool.db.Close(ctx); err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
@@ -0,0 +1,159 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/best-expendables-v2/common-utils/tenant"
+	"github.com/best-expendables-v2/common-utils/transaction"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestSchemaPerTenant(t *testing.T) {
+	configOf := SchemaPerTenant(Config{Dialect: Postgres, Params: map[string]string{"sslmode": "disable"}}, func(tenantID string) string {
+		return "tenant_" + tenantID
+	})
+
+	config, err := configOf(context.Background(), "acme")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"sslmode": "disable", "search_path": "tenant_acme"}, config.Params)
+
+	_, err = configOf(context.Background(), "acme; DROP SCHEMA public")
+	assert.True(t, errors.Is(err, ErrInvalidTenant))
+}
+
+func TestTenantRouter(t *testing.T) {
+	var opened int32
+	mocks := map[string]sqlmock.Sqlmock{}
+	router := NewTenantRouter(DatabasePerTenant(func(ctx context.Context, tenantID string) (Config, error) {
+		if tenantID == "unknown" {
+			return Config{}, errors.New("unknown tenant")
+		}
+		return Config{Name: tenantID}, nil
+	}), WithMaxTenantPools(1))
+	router.open = func(ctx context.Context, config Config) (*DB, error) {
+		atomic.AddInt32(&opened, 1)
+		rawDB, mock, err := sqlmock.New()
+		if err != nil {
+			return nil, err
+		}
+		mock.ExpectClose()
+		mocks[config.Name] = mock
+		db, err := gorm.Open(postgres.New(postgres.Config{Conn: rawDB}), &gorm.Config{})
+		return &DB{DB: db, sqlDB: rawDB}, err
+	}
+
+	acme := tenant.ContextWithTenantID(context.Background(), "acme")
+	first, err := router.DB(acme)
+	assert.NoError(t, err)
+	second, err := router.DB(acme)
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&opened))
+
+	_, err = router.DB(tenant.ContextWithTenantID(context.Background(), "globex"))
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&opened))
+	// acme is evicted and closed as nothing runs on it.
+	assert.Eventually(t, func() bool {
+		return mocks["acme"].ExpectationsWereMet() == nil
+	}, time.Second, 10*time.Millisecond)
+
+	_, err = router.DB(tenant.ContextWithTenantID(context.Background(), "unknown"))
+	assert.EqualError(t, err, "unknown tenant")
+
+	_, err = router.DB(context.Background())
+	assert.Equal(t, ErrTenantRequired, err)
+	assert.True(t, errors.Is(router.Writer(context.Background()).Exec("SELECT 1").Error, ErrTenantRequired))
+	var one int
+	assert.True(t, errors.Is(router.Writer(context.Background()).Raw("SELECT 1").Row().Scan(&one), ErrTenantRequired))
+
+	assert.NoError(t, router.Close(context.Background()))
+	assert.NoError(t, mocks["globex"].ExpectationsWereMet())
+}
+
+func TestTenantRouter_EvictionWaitsForTransactions(t *testing.T) {
+	var opened int32
+	mocks := map[string]sqlmock.Sqlmock{}
+	router := NewTenantRouter(DatabasePerTenant(func(ctx context.Context, tenantID string) (Config, error) {
+		return Config{Name: tenantID}, nil
+	}), WithMaxTenantPools(1))
+	router.open = func(ctx context.Context, config Config) (*DB, error) {
+		rawDB, mock, err := sqlmock.New()
+		if err != nil {
+			return nil, err
+		}
+		name := fmt.Sprint(config.Name, atomic.AddInt32(&opened, 1))
+		if name == "acme3" {
+			mock.ExpectExec("SELECT 1").WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+		mocks[name] = mock
+		db, err := gorm.Open(postgres.New(postgres.Config{Conn: rawDB}), &gorm.Config{})
+		return &DB{DB: db, sqlDB: rawDB}, err
+	}
+
+	acme := tenant.ContextWithTenantID(context.Background(), "acme")
+	db, err := router.DB(acme)
+	assert.NoError(t, err)
+	mocks["acme1"].ExpectBegin()
+	mocks["acme1"].ExpectExec("UPDATE accounts").WillReturnResult(sqlmock.NewResult(0, 1))
+	mocks["acme1"].ExpectCommit()
+	mocks["acme1"].ExpectClose()
+	tx := db.Begin()
+	assert.NoError(t, tx.Error)
+
+	_, err = router.DB(tenant.ContextWithTenantID(context.Background(), "globex"))
+	assert.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	// The evicted pool stays open for the transaction.
+	assert.NoError(t, tx.Exec("UPDATE accounts SET balance = 0").Error)
+	assert.NoError(t, tx.Commit().Error)
+	assert.Eventually(t, func() bool {
+		return mocks["acme1"].ExpectationsWereMet() == nil
+	}, time.Second, 10*time.Millisecond)
+
+	// A database handed out before the eviction reopens the pool of its tenant.
+	assert.NoError(t, db.Exec("SELECT 1").Error)
+	assert.NoError(t, mocks["acme3"].ExpectationsWereMet())
+}
+
+func TestTenantRouter_FailedDBDialect(t *testing.T) {
+	router := NewTenantRouter(DatabasePerTenant(func(ctx context.Context, tenantID string) (Config, error) {
+		return Config{}, nil
+	}), WithTenantDialect(MariaDB))
+
+	db := router.Writer(context.Background())
+	assert.Equal(t, "mysql", db.Dialector.Name())
+	assert.True(t, errors.Is(db.Exec("SELECT 1").Error, ErrTenantRequired))
+}
+
+func TestTenantRouter_TxManager(t *testing.T) {
+	rawDB, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: rawDB}), &gorm.Config{})
+	assert.NoError(t, err)
+	router := NewTenantRouter(DatabasePerTenant(func(ctx context.Context, tenantID string) (Config, error) {
+		return Config{Name: tenantID}, nil
+	}))
+	router.open = func(ctx context.Context, config Config) (*DB, error) {
+		return &DB{DB: db, sqlDB: rawDB}, nil
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE accounts").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	ctx := tenant.ContextWithTenantID(context.Background(), "acme")
+	err = transaction.NewTxManagerFunc(router.Writer).RunInTx(ctx, func(ctx context.Context) error {
+		return transaction.GetTnx(ctx).(*gorm.DB).Exec("UPDATE accounts SET balance = 0").Error
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
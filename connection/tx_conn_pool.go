@@ -0,0 +1,93 @@
+package connection
+
+import (
+	"context"
+	"database/sql"
+
+	"gorm.io/gorm"
+)
+
+// RetryableTxError reports a retryable failure inside a transaction. The
+// statement cannot be retried on its own since the transaction may be gone,
+// the whole transaction has to be replayed, see transaction.TnxManager.RunInTx.
+type RetryableTxError struct {
+	Err error
+}
+
+func (e *RetryableTxError) Error() string {
+	return "transaction must be retried: " + e.Err.Error()
+}
+
+func (e *RetryableTxError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RetryableTxError) TxRetryable() bool {
+	return true
+}
+
+// TxConnPool runs the statements of a transaction started through ConnPool.
+type TxConnPool struct {
+	pluginRetry *pluginRetry
+	gorm.ConnPool
+}
+
+func (s *TxConnPool) String() string {
+	return "gorm:db_retry:tx_conn_pool"
+}
+
+func (s *TxConnPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	result, err := s.ConnPool.PrepareContext(ctx, query)
+	return result, s.wrap(err)
+}
+
+func (s *TxConnPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	result, err := s.ConnPool.ExecContext(ctx, query, args...)
+	return result, s.wrap(err)
+}
+
+func (s *TxConnPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	result, err := s.ConnPool.QueryContext(ctx, query, args...)
+	return result, s.wrap(err)
+}
+
+// Commit only asks for a replay when the server refused to commit. When the
+// connection fails the transaction may have committed already, replaying it
+// could apply it twice.
+func (s *TxConnPool) Commit() error {
+	if committer, ok := s.ConnPool.(gorm.TxCommitter); ok {
+		err := committer.Commit()
+		if err != nil && matchCommitConflict(err) {
+			return s.wrap(err)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *TxConnPool) Rollback() error {
+	if committer, ok := s.ConnPool.(gorm.TxCommitter); ok {
+		return committer.Rollback()
+	}
+	return nil
+}
+
+func (s *TxConnPool) GetDBConn() (*sql.DB, error) {
+	return s.pluginRetry.sqlDB, nil
+}
+
+// matchCommitConflict matches the serialization failures and deadlocks the
+// server reports when it rolls back at commit.
+func matchCommitConflict(err error) bool {
+	return MatchPostgresCodes("40001", "40P01")(err) || MatchMySQLNumbers(1213)(err)
+}
+
+func (s *TxConnPool) wrap(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := s.pluginRetry.classifier.Classify(err); ok {
+		return &RetryableTxError{Err: err}
+	}
+	return err
+}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+
+	"github.com/best-expendables-v2/common-utils/util"
+	"gorm.io/gorm"
+)
+
+// AuditableModel records who created and last updated a model. Embed it next
+// to BaseModel, whose hooks fill it from the user of the statement context.
+type AuditableModel struct {
+	CreatedBy string `json:"createdBy"`
+	UpdatedBy string `json:"updatedBy"`
+}
+
+func (m *AuditableModel) auditableModel() *AuditableModel {
+	return m
+}
+
+type auditable interface {
+	auditableModel() *AuditableModel
+}
+
+var fallbackActor atomic.Value
+
+// SetFallbackActor sets who AuditableModel names when the context has no
+// user, e.g. "system" for background jobs.
+func SetFallbackActor(actor string) {
+	fallbackActor.Store(actor)
+}
+
+// Actor returns who writes with ctx, the fallback actor when it has no user.
+func Actor(ctx context.Context) string {
+	if userID := util.GetUserIDFromContext(ctx); userID != "" {
+		return userID
+	}
+	actor, _ := fallbackActor.Load().(string)
+	return actor
+}
+
+// auditableOf returns the AuditableModel of the row a hook runs for, nil
+// when the model does not embed one.
+func auditableOf(tx *gorm.DB) *AuditableModel {
+	row := tx.Statement.ReflectValue
+	if row.Kind() == reflect.Slice || row.Kind() == reflect.Array {
+		row = row.Index(tx.Statement.CurDestIndex)
+	}
+	row = reflect.Indirect(row)
+	if !row.CanAddr() {
+		return nil
+	}
+	if m, ok := row.Addr().Interface().(auditable); ok {
+		return m.auditableModel()
+	}
+	return nil
+}
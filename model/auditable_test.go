@@ -0,0 +1,57 @@
+package model
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	userclient "github.com/best-expendables-v2/user-service-client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type invoice struct {
+	BaseModel
+	AuditableModel
+	Total int
+}
+
+func TestAuditableModel(t *testing.T) {
+	rawDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: rawDB}), &gorm.Config{SkipDefaultTransaction: true})
+	require.NoError(t, err)
+	ctx := userclient.ContextWithUser(context.Background(), &userclient.User{Id: "u1"})
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "invoices" ("id","created_at","updated_at","created_by","updated_by","total")`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "u1", "u1", 10).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "invoices" ("id","created_at","updated_at","created_by","updated_by","total")`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "importer", "system", 20).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "invoices" SET "updated_at"=$1,"updated_by"=$2,"total"=$3 WHERE "id" = $4`)).
+		WithArgs(sqlmock.AnyArg(), "u1", 30, "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "invoices" SET "updated_at"=$1,"total"=$2 WHERE "id" = $3`)).
+		WithArgs(sqlmock.AnyArg(), 40, "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	i := &invoice{Total: 10}
+	assert.NoError(t, db.WithContext(ctx).Create(i).Error)
+	assert.Equal(t, "u1", i.CreatedBy)
+
+	SetFallbackActor("system")
+	defer SetFallbackActor("")
+	assert.NoError(t, db.Create(&invoice{AuditableModel: AuditableModel{CreatedBy: "importer"}, Total: 20}).Error)
+
+	assert.NoError(t, db.WithContext(ctx).Model(&invoice{BaseModel: BaseModel{Id: "1"}}).Updates(map[string]interface{}{"total": 30}).Error)
+
+	SetFallbackActor("")
+	updated := &invoice{BaseModel: BaseModel{Id: "1"}, AuditableModel: AuditableModel{UpdatedBy: "u1"}}
+	assert.NoError(t, db.Model(updated).Updates(map[string]interface{}{"total": 40}).Error)
+	assert.Equal(t, "u1", updated.UpdatedBy)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -41,12 +41,25 @@ func (m *BaseModel) BeforeCreate(tx *gorm.DB) error {
 	if m.UpdatedAt.IsZero() {
 		tx.Statement.SetColumn("UpdatedAt", now)
 	}
+	if audited := auditableOf(tx); audited != nil {
+		actor := Actor(tx.Statement.Context)
+		if audited.CreatedBy == "" {
+			tx.Statement.SetColumn("CreatedBy", actor)
+		}
+		if audited.UpdatedBy == "" {
+			tx.Statement.SetColumn("UpdatedBy", actor)
+		}
+	}
 	return nil
 }
 
 func (m *BaseModel) BeforeUpdate(tx *gorm.DB) error {
 	now := time.Now()
 	tx.Statement.SetColumn("UpdatedAt", now)
+	// Without an actor the stored one is kept rather than wiped.
+	if actor := Actor(tx.Statement.Context); actor != "" && auditableOf(tx) != nil {
+		tx.Statement.SetColumn("UpdatedBy", actor)
+	}
 	return nil
 }
 
@@ -0,0 +1,31 @@
+package model
+
+import "gorm.io/gorm"
+
+const (
+	DeletedAtColumn = "deleted_at"
+	DeletedByColumn = "deleted_by"
+)
+
+// SoftDeletable models are only marked as deleted, in DeletedAtColumn and
+// DeletedByColumn, see SoftDeletableModel.
+type SoftDeletable interface {
+	IsDeleted() bool
+}
+
+// SoftDeleteCascader lists the has one and has many associations soft
+// deleted along with the model, their models must be SoftDeletable too.
+type SoftDeleteCascader interface {
+	SoftDeleteCascade() []string
+}
+
+// SoftDeletableModel makes deletes set DeletedAt and DeletedBy, and queries
+// skip the deleted rows unless unscoped. Embed it next to BaseModel.
+type SoftDeletableModel struct {
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deletedAt,omitempty"`
+	DeletedBy string         `json:"deletedBy,omitempty"`
+}
+
+func (m *SoftDeletableModel) IsDeleted() bool {
+	return m.DeletedAt.Valid
+}
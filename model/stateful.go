@@ -0,0 +1,9 @@
+package model
+
+// Stateful models move between statuses through a state machine, see
+// package statemachine.
+type Stateful interface {
+	Model
+	GetStatus() string
+	SetStatus(status string)
+}
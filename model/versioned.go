@@ -0,0 +1,25 @@
+package model
+
+// VersionColumn holds the version of a VersionedModel.
+const VersionColumn = "version"
+
+// Versioned models are updated with optimistic locking: an update only
+// applies to the version that was read and increments it.
+type Versioned interface {
+	GetVersion() int64
+	SetVersion(version int64)
+}
+
+// VersionedModel opts a model into optimistic locking, embed it next to
+// BaseModel.
+type VersionedModel struct {
+	Version int64 `gorm:"not null" json:"version"`
+}
+
+func (m *VersionedModel) GetVersion() int64 {
+	return m.Version
+}
+
+func (m *VersionedModel) SetVersion(version int64) {
+	m.Version = version
+}
@@ -0,0 +1,227 @@
+package cached_repo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/best-expendables-v2/common-utils/cache"
+	"github.com/best-expendables-v2/common-utils/model"
+	"github.com/best-expendables-v2/common-utils/repository"
+	"github.com/best-expendables-v2/common-utils/repository/filter"
+	"github.com/best-expendables-v2/common-utils/transaction"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	_ repository.BaseRepo       = (*CachedRepo)(nil)
+	_ repository.SoftRemovable  = (*CachedRepo)(nil)
+	_ repository.BulkWritable   = (*CachedRepo)(nil)
+	_ repository.Transitionable = (*CachedRepo)(nil)
+)
+
+// ErrNotSupported is returned by the writes the wrapped repository does not implement.
+var ErrNotSupported = errors.New("repository does not support the operation")
+
+// CachedRepo is a read-through cache in front of a repository.BaseRepo.
+// FindByID results are cached by table and ID and invalidated on every
+// write, once the surrounding transaction (if any) has been committed. The
+// soft delete, bulk and transition writes are passed on when the wrapped
+// repository implements them.
+type CachedRepo struct {
+	repository.BaseRepo
+	cache cache.Cache
+	opts  []cache.Option
+}
+
+func NewCachedRepo(repo repository.BaseRepo, c cache.Cache, opts ...cache.Option) *CachedRepo {
+	return &CachedRepo{
+		BaseRepo: repo,
+		cache:    c,
+		opts:     opts,
+	}
+}
+
+// FindByID only uses the cache for plain lookups: preloads, unscoped reads and
+// reads inside a transaction always go to the database.
+func (r *CachedRepo) FindByID(ctx context.Context, m model.Model, id string, preloadFields ...string) error {
+	if len(preloadFields) > 0 || filter.GetUnscoped(ctx) || transaction.GetTnx(ctx) != nil {
+		return r.BaseRepo.FindByID(ctx, m, id, preloadFields...)
+	}
+
+	key := CacheKey(m, id)
+	if err := r.cache.Get(ctx, key, m); err == nil {
+		return nil
+	}
+	if err := r.BaseRepo.FindByID(ctx, m, id); err != nil {
+		return err
+	}
+	_ = r.cache.Set(ctx, key, m, r.opts...)
+	return nil
+}
+
+func (r *CachedRepo) CreateOrUpdate(ctx context.Context, m model.Model, query interface{}, attrs ...interface{}) error {
+	if err := r.BaseRepo.CreateOrUpdate(ctx, m, query, attrs...); err != nil {
+		return err
+	}
+	r.invalidate(ctx, m, m.GetID())
+	return nil
+}
+
+func (r *CachedRepo) Update(ctx context.Context, m model.Model, attrs ...interface{}) error {
+	if err := r.BaseRepo.Update(ctx, m, attrs...); err != nil {
+		return err
+	}
+	r.invalidate(ctx, m, m.GetID())
+	return nil
+}
+
+func (r *CachedRepo) Updates(ctx context.Context, m model.Model, params interface{}) error {
+	if err := r.BaseRepo.Updates(ctx, m, params); err != nil {
+		return err
+	}
+	r.invalidate(ctx, m, m.GetID())
+	return nil
+}
+
+func (r *CachedRepo) Save(ctx context.Context, m model.Model) error {
+	if err := r.BaseRepo.Save(ctx, m); err != nil {
+		return err
+	}
+	r.invalidate(ctx, m, m.GetID())
+	return nil
+}
+
+func (r *CachedRepo) Create(ctx context.Context, m model.Model) error {
+	if err := r.BaseRepo.Create(ctx, m); err != nil {
+		return err
+	}
+	r.invalidate(ctx, m, m.GetID())
+	return nil
+}
+
+func (r *CachedRepo) DeleteByID(ctx context.Context, m model.Model, id string) error {
+	if err := r.BaseRepo.DeleteByID(ctx, m, id); err != nil {
+		return err
+	}
+	r.invalidate(ctx, m, id)
+	return nil
+}
+
+func (r *CachedRepo) Transition(ctx context.Context, m model.Stateful, status string) error {
+	transitionable, ok := r.BaseRepo.(repository.Transitionable)
+	if !ok {
+		return ErrNotSupported
+	}
+	if err := transitionable.Transition(ctx, m, status); err != nil {
+		return err
+	}
+	r.invalidate(ctx, m, m.GetID())
+	return nil
+}
+
+func (r *CachedRepo) Restore(ctx context.Context, m model.Model, id string) error {
+	removable, ok := r.BaseRepo.(repository.SoftRemovable)
+	if !ok {
+		return ErrNotSupported
+	}
+	if err := removable.Restore(ctx, m, id); err != nil {
+		return err
+	}
+	r.invalidate(ctx, m, id)
+	return nil
+}
+
+func (r *CachedRepo) ForceDelete(ctx context.Context, m model.Model, id string) error {
+	removable, ok := r.BaseRepo.(repository.SoftRemovable)
+	if !ok {
+		return ErrNotSupported
+	}
+	if err := removable.ForceDelete(ctx, m, id); err != nil {
+		return err
+	}
+	r.invalidate(ctx, m, id)
+	return nil
+}
+
+// PurgeDeletedBefore invalidates nothing: only soft deleted rows are purged,
+// and those are never cached since unscoped reads bypass the cache.
+func (r *CachedRepo) PurgeDeletedBefore(ctx context.Context, m model.Model, before time.Time) (int64, error) {
+	removable, ok := r.BaseRepo.(repository.SoftRemovable)
+	if !ok {
+		return 0, ErrNotSupported
+	}
+	return removable.PurgeDeletedBefore(ctx, m, before)
+}
+
+func (r *CachedRepo) BulkInsert(ctx context.Context, arr []model.Model) (repository.BulkResult, error) {
+	bulk, ok := r.BaseRepo.(repository.BulkWritable)
+	if !ok {
+		return repository.BulkResult{}, ErrNotSupported
+	}
+	return bulk.BulkInsert(ctx, arr)
+}
+
+func (r *CachedRepo) BulkUpsert(ctx context.Context, arr []model.Model, conflictColumns []string, updateColumns ...string) (repository.BulkResult, error) {
+	bulk, ok := r.BaseRepo.(repository.BulkWritable)
+	if !ok {
+		return repository.BulkResult{}, ErrNotSupported
+	}
+	result, err := bulk.BulkUpsert(ctx, arr, conflictColumns, updateColumns...)
+	if err != nil {
+		return result, err
+	}
+	r.invalidateAll(ctx, arr, result)
+	return result, nil
+}
+
+func (r *CachedRepo) BulkUpdate(ctx context.Context, arr []model.Model, columns ...string) (repository.BulkResult, error) {
+	bulk, ok := r.BaseRepo.(repository.BulkWritable)
+	if !ok {
+		return repository.BulkResult{}, ErrNotSupported
+	}
+	result, err := bulk.BulkUpdate(ctx, arr, columns...)
+	if err != nil {
+		return result, err
+	}
+	r.invalidateAll(ctx, arr, result)
+	return result, nil
+}
+
+// invalidateAll invalidates the models of a bulk write and the rows it
+// returned, an upsert with RETURNING may have written other IDs than arr's.
+func (r *CachedRepo) invalidateAll(ctx context.Context, arr []model.Model, result repository.BulkResult) {
+	if len(arr) == 0 {
+		return
+	}
+	for _, m := range arr {
+		r.invalidate(ctx, m, m.GetID())
+	}
+	for _, id := range result.IDs {
+		r.invalidate(ctx, arr[0], id)
+	}
+}
+
+func (r *CachedRepo) invalidate(ctx context.Context, m model.Model, id string) {
+	if id == "" {
+		return
+	}
+	key := CacheKey(m, id)
+	transaction.AfterCommit(ctx, func() {
+		_ = r.cache.Delete(ctx, key)
+	})
+}
+
+// CacheKey returns the cache key of the record id of m's table.
+func CacheKey(m model.Model, id string) string {
+	return TableName(m) + ":" + id
+}
+
+// TableName resolves the table of m the way gorm does by default.
+func TableName(m model.Model) string {
+	if t, ok := m.(schema.Tabler); ok {
+		return t.TableName()
+	}
+	return schema.NamingStrategy{}.TableName(reflect.Indirect(reflect.ValueOf(m)).Type().Name())
+}
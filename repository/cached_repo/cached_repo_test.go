@@ -0,0 +1,148 @@
+package cached_repo
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/best-expendables-v2/common-utils/cache"
+	"github.com/best-expendables-v2/common-utils/model"
+	"github.com/best-expendables-v2/common-utils/repository"
+	"github.com/best-expendables-v2/common-utils/transaction"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type ShippingProvider struct {
+	model.BaseModel
+	Name string `json:"name"`
+}
+
+type stubRepo struct {
+	repository.BaseRepo
+	finds int
+}
+
+func (r *stubRepo) FindByID(ctx context.Context, m model.Model, id string, preloadFields ...string) error {
+	r.finds++
+	p := m.(*ShippingProvider)
+	p.Id = id
+	p.Name = "provider"
+	return nil
+}
+
+func (r *stubRepo) Updates(ctx context.Context, m model.Model, params interface{}) error {
+	return nil
+}
+
+type stubWritableRepo struct {
+	stubRepo
+	repository.SoftRemovable
+	repository.BulkWritable
+}
+
+func (r *stubWritableRepo) Restore(ctx context.Context, m model.Model, id string) error {
+	return nil
+}
+
+func (r *stubWritableRepo) BulkUpdate(ctx context.Context, arr []model.Model, columns ...string) (repository.BulkResult, error) {
+	return repository.BulkResult{RowsAffected: int64(len(arr))}, nil
+}
+
+type stubCache struct {
+	cache.Cache
+	values map[string][]byte
+}
+
+func (c *stubCache) Get(ctx context.Context, key string, obj interface{}, opts ...cache.Option) error {
+	b, ok := c.values[key]
+	if !ok {
+		return cache.Nil
+	}
+	return json.Unmarshal(b, obj)
+}
+
+func (c *stubCache) Set(ctx context.Context, key string, obj interface{}, opts ...cache.Option) error {
+	b, err := json.Marshal(obj)
+	c.values[key] = b
+	return err
+}
+
+func (c *stubCache) Delete(ctx context.Context, key string) error {
+	delete(c.values, key)
+	return nil
+}
+
+func TestCachedRepo_FindByID(t *testing.T) {
+	ctx := context.Background()
+	base := &stubRepo{}
+	c := &stubCache{values: map[string][]byte{}}
+	repo := NewCachedRepo(base, c)
+
+	var p ShippingProvider
+	assert.NoError(t, repo.FindByID(ctx, &p, "1"))
+	assert.NoError(t, repo.FindByID(ctx, &p, "1"))
+	assert.Equal(t, 1, base.finds)
+	assert.Contains(t, c.values, "shipping_providers:1")
+
+	assert.NoError(t, repo.FindByID(ctx, &p, "1", "Address"))
+	assert.Equal(t, 2, base.finds)
+
+	assert.NoError(t, repo.Updates(ctx, &p, map[string]interface{}{"name": "other"}))
+	assert.NotContains(t, c.values, "shipping_providers:1")
+}
+
+func TestCachedRepo_InvalidateAfterCommit(t *testing.T) {
+	rawDB, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: rawDB}), &gorm.Config{})
+	assert.NoError(t, err)
+	tnxManager := transaction.NewTxManager(db)
+
+	c := &stubCache{values: map[string][]byte{}}
+	repo := NewCachedRepo(&stubRepo{}, c)
+	p := ShippingProvider{BaseModel: model.BaseModel{Id: "1"}}
+	assert.NoError(t, repo.FindByID(context.Background(), &p, "1"))
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	tnx, ctx := tnxManager.Start(context.Background())
+	assert.NoError(t, repo.Updates(ctx, &p, map[string]interface{}{"name": "other"}))
+	tnx.RollBack()
+	assert.Contains(t, c.values, "shipping_providers:1")
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	tnx, ctx = tnxManager.Start(context.Background())
+	assert.NoError(t, repo.Updates(ctx, &p, map[string]interface{}{"name": "other"}))
+	assert.Contains(t, c.values, "shipping_providers:1")
+	assert.NoError(t, tnx.Finish(nil))
+	assert.NotContains(t, c.values, "shipping_providers:1")
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCachedRepo_InvalidateOtherWrites(t *testing.T) {
+	ctx := context.Background()
+	c := &stubCache{values: map[string][]byte{}}
+	repo := NewCachedRepo(&stubWritableRepo{}, c)
+
+	var p ShippingProvider
+	assert.NoError(t, repo.FindByID(ctx, &p, "1"))
+	assert.NoError(t, repo.Restore(ctx, &p, "1"))
+	assert.NotContains(t, c.values, "shipping_providers:1")
+
+	assert.NoError(t, repo.FindByID(ctx, &p, "1"))
+	_, err := repo.BulkUpdate(ctx, []model.Model{&p})
+	assert.NoError(t, err)
+	assert.NotContains(t, c.values, "shipping_providers:1")
+}
+
+func TestCachedRepo_NotSupported(t *testing.T) {
+	repo := NewCachedRepo(&stubRepo{}, &stubCache{values: map[string][]byte{}})
+	assert.Equal(t, ErrNotSupported, repo.Restore(context.Background(), &ShippingProvider{}, "1"))
+	_, err := repo.BulkUpdate(context.Background(), nil)
+	assert.Equal(t, ErrNotSupported, err)
+}
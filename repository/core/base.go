@@ -0,0 +1,336 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/best-expendables-v2/common-utils/connection"
+	"github.com/best-expendables-v2/common-utils/model"
+	"github.com/best-expendables-v2/common-utils/repository"
+	"github.com/best-expendables-v2/common-utils/repository/filter"
+	"github.com/best-expendables-v2/common-utils/statemachine"
+	"github.com/best-expendables-v2/common-utils/transaction"
+	nrcontext "github.com/best-expendables-v2/newrelic-context"
+	"github.com/fatih/structs"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var _ repository.BaseRepo = (*BaseRepo)(nil)
+
+// BaseRepo implements repository.BaseRepo for every SQL database, what
+// differs between them comes from its Dialect.
+type BaseRepo struct {
+	db       *gorm.DB
+	resolver connection.DBResolver
+	dialect  Dialect
+	machines *statemachine.Registry
+	// schemas caches the models parsed with namer, which need no connection.
+	schemas *sync.Map
+	namer   schema.Namer
+}
+
+func NewBaseRepo(db *gorm.DB, dialect Dialect) *BaseRepo {
+	return &BaseRepo{
+		db:      db,
+		dialect: dialect,
+		schemas: &sync.Map{},
+		namer:   db.NamingStrategy,
+	}
+}
+
+// NewBaseRepoWithResolver sends writes to the resolver's writer and
+// Search*/FindByID* reads to its reader. Models are parsed with the default
+// naming strategy, the resolver may not have a database outside of a request.
+func NewBaseRepoWithResolver(resolver connection.DBResolver, dialect Dialect) *BaseRepo {
+	return &BaseRepo{
+		resolver: resolver,
+		dialect:  dialect,
+		schemas:  &sync.Map{},
+		namer:    schema.NamingStrategy{},
+	}
+}
+
+func (r *BaseRepo) Dialect() Dialect {
+	return r.dialect
+}
+
+func (r *BaseRepo) GetDB(ctx context.Context) *gorm.DB {
+	db := r.db
+	if r.resolver != nil {
+		db = r.resolver.Writer(ctx)
+	}
+	return r.bind(ctx, db)
+}
+
+// GetReadDB returns the database reads should go to, a replica when the
+// repository has a resolver.
+func (r *BaseRepo) GetReadDB(ctx context.Context) *gorm.DB {
+	db := r.db
+	if r.resolver != nil {
+		db = r.resolver.Reader(ctx)
+	}
+	return r.bind(ctx, db)
+}
+
+func (r *BaseRepo) bind(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if tnx := transaction.GetTnx(ctx); tnx != nil {
+		db = tnx.(*gorm.DB)
+	}
+	// Binding ctx cancels the statement when the request is gone.
+	db = nrcontext.SetTxnToGorm(ctx, db.WithContext(ctx))
+	return db
+}
+
+func (r *BaseRepo) FindByIDWithPreloadCondition(ctx context.Context, m model.Model, id string, preloadFields ...repository.PreloadField) error {
+	q := r.GetReadDB(ctx)
+	if filter.GetUnscoped(ctx) {
+		q = q.Unscoped()
+	}
+	q = preloadWithConditions(ctx, q, preloadFields)
+	return findError(q.Where("id = ?", id).Take(m).Error)
+}
+
+func (r *BaseRepo) FindByID(ctx context.Context, m model.Model, id string, preloadFields ...string) error {
+	q := r.GetReadDB(ctx)
+	if filter.GetUnscoped(ctx) {
+		q = q.Unscoped()
+	}
+	q = preload(ctx, q, preloadFields)
+	return findError(q.Where("id = ?", id).Take(m).Error)
+}
+
+func findError(err error) error {
+	if err == gorm.ErrRecordNotFound {
+		return repository.RecordNotFound
+	}
+	return err
+}
+
+func (r *BaseRepo) CreateOrUpdate(ctx context.Context, m model.Model, query interface{}, attrs ...interface{}) error {
+	return r.GetDB(ctx).Where(query).Assign(attrs...).FirstOrCreate(m).Error
+}
+
+func (r *BaseRepo) Update(ctx context.Context, m model.Model, attrs ...interface{}) error {
+	return r.Updates(ctx, m, toSearchableMap(attrs...))
+}
+
+func (r *BaseRepo) Updates(ctx context.Context, m model.Model, params interface{}) error {
+	if versioned, ok := m.(model.Versioned); ok {
+		return r.updateVersion(r.GetDB(ctx).Model(m), versioned, params)
+	}
+	return r.GetDB(ctx).Model(m).Updates(params).Error
+}
+
+// updateVersion runs the update of q only when the row still has the
+// version of m, and moves both to the next version.
+func (r *BaseRepo) updateVersion(q *gorm.DB, m model.Versioned, params interface{}) error {
+	version := m.GetVersion()
+	tx := q.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: model.VersionColumn}, Value: version}).
+		Omit(model.VersionColumn).
+		Clauses(appendAssignment(clause.Expr{SQL: fmt.Sprintf(",%[1]s = %[1]s + 1", r.dialect.Quote(model.VersionColumn))})).
+		Updates(params)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return repository.ErrStaleRecord
+	}
+	m.SetVersion(version + 1)
+	return nil
+}
+
+// appendAssignment adds to the SET clause gorm builds, e.g. the version
+// increment of updateVersion. The SQL starts with a comma, it follows a no-op
+// assignment of the primary key when gorm has nothing else to set.
+type appendAssignment clause.Expr
+
+func (appendAssignment) Name() string {
+	return "SET"
+}
+
+func (appendAssignment) Build(clause.Builder) {
+}
+
+func (a appendAssignment) MergeClause(c *clause.Clause) {
+	if c.Expression == nil {
+		c.Expression = clause.Set{}
+	}
+	c.AfterExpression = clause.Expr(a)
+}
+
+func (r *BaseRepo) Create(ctx context.Context, m model.Model) error {
+	return r.GetDB(ctx).Create(m).Error
+}
+
+// filtered applies the conditions, joins and groups of f, but not its
+// pagination nor ordering so that the result can be counted.
+func (r *BaseRepo) filtered(ctx context.Context, val interface{}, f filter.Filter) *gorm.DB {
+	q := r.conditions(ctx, r.GetReadDB(ctx).Model(val), f)
+	return scoped(ctx, q, f)
+}
+
+// groupedFiltered is filtered with the conditions of f in parentheses, so
+// that more conditions can be ANDed to them.
+func (r *BaseRepo) groupedFiltered(ctx context.Context, val interface{}, f filter.Filter) *gorm.DB {
+	q := r.GetReadDB(ctx).Model(val)
+	if len(f.GetWhere()) > 0 || len(f.GetOrWhere()) > 0 || len(f.GetOrWhereGroup()) > 0 {
+		q = q.Where(r.conditions(ctx, r.GetReadDB(ctx), f))
+	}
+	return scoped(ctx, q, f)
+}
+
+func (r *BaseRepo) conditions(ctx context.Context, q *gorm.DB, f filter.Filter) *gorm.DB {
+	for query, args := range f.GetWhere() {
+		q = q.Where(query, args...)
+	}
+	for query, args := range f.GetOrWhere() {
+		q = q.Or(query, args...)
+	}
+	if len(f.GetOrWhereGroup()) > 0 {
+		orWhereGroup := r.GetReadDB(ctx)
+		for query, args := range f.GetOrWhereGroup() {
+			orWhereGroup = orWhereGroup.Where(query, args...)
+		}
+		q = q.Or(orWhereGroup)
+	}
+	return q
+}
+
+func scoped(ctx context.Context, q *gorm.DB, f filter.Filter) *gorm.DB {
+	if filter.GetUnscoped(ctx) {
+		q = q.Unscoped()
+	}
+	for _, join := range f.GetJoins() {
+		q = q.Joins(join.Query, join.Args...)
+	}
+	if f.GetGroups() != "" {
+		q = q.Group(f.GetGroups())
+	}
+	return q
+}
+
+func paginate(q *gorm.DB, f filter.Filter) *gorm.DB {
+	if f.GetLimit() > 0 {
+		q = q.Limit(f.GetLimit())
+	}
+	for _, order := range f.GetOrderBy() {
+		q = q.Order(order)
+	}
+	return q.Offset(f.GetOffset())
+}
+
+func preload(ctx context.Context, q *gorm.DB, preloadFields []string) *gorm.DB {
+	isPreloadUnscoped := filter.GetPreloadUnscoped(ctx)
+	for _, p := range preloadFields {
+		if isPreloadUnscoped {
+			q = q.Preload(p, func(db *gorm.DB) *gorm.DB {
+				return db.Unscoped()
+			})
+		} else {
+			q = q.Preload(p)
+		}
+	}
+	return q
+}
+
+func preloadWithConditions(ctx context.Context, q *gorm.DB, preloadFields []repository.PreloadField) *gorm.DB {
+	isPreloadUnscoped := filter.GetPreloadUnscoped(ctx)
+	for _, p := range preloadFields {
+		if isPreloadUnscoped {
+			p.Conditions = append(p.Conditions, func(db *gorm.DB) *gorm.DB { return db.Unscoped() })
+		}
+		q = q.Preload(p.FieldName, p.Conditions...)
+	}
+	return q
+}
+
+func (r *BaseRepo) SearchWithPreloadCondition(ctx context.Context, val interface{}, f filter.Filter, preloadFields ...repository.PreloadField) error {
+	q := preloadWithConditions(ctx, paginate(r.filtered(ctx, val, f), f), preloadFields)
+	return q.Find(val).Error
+}
+
+func (r *BaseRepo) Search(ctx context.Context, val interface{}, f filter.Filter, preloadFields ...string) error {
+	q := preload(ctx, paginate(r.filtered(ctx, val, f), f), preloadFields)
+	return q.Find(val).Error
+}
+
+func (r *BaseRepo) SearchAndCount(ctx context.Context, val interface{}, f filter.Filter, preloadFields ...string) (int64, error) {
+	var count int64
+	q := r.filtered(ctx, val, f)
+	if err := q.Count(&count).Error; err != nil {
+		return 0, err
+	}
+	q = preload(ctx, paginate(q, f), preloadFields)
+	return count, q.Find(val).Error
+}
+
+func (r *BaseRepo) SearchWithPreloadConditionAndCount(ctx context.Context, val interface{}, f filter.Filter, preloadFields ...repository.PreloadField) (int64, error) {
+	var count int64
+	q := r.filtered(ctx, val, f)
+	if err := q.Count(&count).Error; err != nil {
+		return 0, err
+	}
+	q = preloadWithConditions(ctx, paginate(q, f), preloadFields)
+	return count, q.Find(val).Error
+}
+
+// Save writes every column of m, a model.Versioned only over the version it
+// was read with.
+// Save updates or, for a model without a row, creates m. A model.Versioned
+// with an id is only updated, from the version it was read at, a missing row
+// being ErrStaleRecord: create those with Create.
+func (r *BaseRepo) Save(ctx context.Context, m model.Model) error {
+	if versioned, ok := m.(model.Versioned); ok && m.GetID() != "" {
+		return r.updateVersion(r.GetDB(ctx).Model(m).Select("*"), versioned, m)
+	}
+	return r.GetDB(ctx).Model(m).Save(m).Error
+}
+
+func (r *BaseRepo) DeleteByID(ctx context.Context, m model.Model, id string) error {
+	db := r.GetDB(ctx).Where("id = ?", id).Take(m)
+	if db.Error != nil || m.GetID() == "" {
+		return repository.RecordNotFound
+	}
+	if _, ok := m.(model.SoftDeletable); ok {
+		return r.softDelete(ctx, m)
+	}
+	return db.Delete(m).Error
+}
+
+func redirectReflectPtrToElem(reflectValue reflect.Value) reflect.Value {
+	for reflectValue.Kind() == reflect.Ptr {
+		reflectValue = reflectValue.Elem()
+	}
+	return reflectValue
+}
+
+func toSearchableMap(attrs ...interface{}) (result interface{}) {
+	if len(attrs) > 1 {
+		if str, ok := attrs[0].(string); ok {
+			result = map[string]interface{}{str: attrs[1]}
+		}
+	} else if len(attrs) == 1 {
+		if attr, ok := attrs[0].(map[string]interface{}); ok {
+			result = attr
+		}
+
+		if attr, ok := attrs[0].(interface{}); ok {
+			s := structs.New(attr)
+			s.TagName = "json"
+			m := s.Map()
+
+			value := make(map[string]interface{}, len(m))
+			var ns schema.NamingStrategy
+			for col, val := range m {
+				dbCol := ns.ColumnName("", col)
+				value[dbCol] = val
+			}
+			result = value
+		}
+	}
+	return
+}
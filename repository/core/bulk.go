@@ -0,0 +1,281 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/best-expendables-v2/common-utils/model"
+	"github.com/best-expendables-v2/common-utils/repository"
+	"github.com/best-expendables-v2/common-utils/transaction"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+var _ repository.BulkWritable = (*BaseRepo)(nil)
+
+// BulkCreate inserts arr, see BulkInsert.
+func (r *BaseRepo) BulkCreate(ctx context.Context, arr []model.Model) error {
+	_, err := r.BulkInsert(ctx, arr)
+	return err
+}
+
+// BulkInsert inserts arr with multi-row INSERTs, split so that no statement
+// exceeds the placeholders allowed by the dialect. The statements share one
+// transaction and the IDs are those BeforeCreate gave to arr.
+func (r *BaseRepo) BulkInsert(ctx context.Context, arr []model.Model) (repository.BulkResult, error) {
+	return r.bulkInsert(ctx, arr, func(*schema.Schema) string { return "" })
+}
+
+// BulkUpsert inserts arr and updates the existing rows on a conflict over
+// conflictColumns, every column but the key and creation ones when
+// updateColumns is empty. With RETURNING the IDs are those of the written
+// rows, otherwise the ones of arr. MySQL counts an updated row twice.
+// Versioned models are refused, see repository.ErrVersionedUpsert.
+func (r *BaseRepo) BulkUpsert(ctx context.Context, arr []model.Model, conflictColumns []string, updateColumns ...string) (repository.BulkResult, error) {
+	for _, val := range arr {
+		if _, ok := val.(model.Versioned); ok {
+			return repository.BulkResult{}, repository.ErrVersionedUpsert
+		}
+	}
+	return r.bulkInsert(ctx, arr, func(s *schema.Schema) string {
+		if len(updateColumns) == 0 {
+			updateColumns = updatableColumns(s, conflictColumns)
+		}
+		return r.dialect.UpsertClause(conflictColumns, updateColumns)
+	})
+}
+
+func (r *BaseRepo) bulkInsert(ctx context.Context, arr []model.Model, onConflict func(s *schema.Schema) string) (repository.BulkResult, error) {
+	var result repository.BulkResult
+	if len(arr) == 0 {
+		return result, nil
+	}
+	db := r.GetDB(ctx)
+	s, err := parseSchema(db, arr[0])
+	if err != nil {
+		return result, err
+	}
+	var fields []*schema.Field
+	var columns []string
+	for _, field := range s.Fields {
+		if field.DBName != "" && field.Creatable && !field.AutoIncrement {
+			fields = append(fields, field)
+			columns = append(columns, r.dialect.Quote(field.DBName))
+		}
+	}
+	if len(fields) == 0 {
+		return result, fmt.Errorf("%s has no column to insert", s.Name)
+	}
+	rowsPerStatement := r.dialect.MaxPlaceholders() / len(fields)
+	if rowsPerStatement == 0 {
+		return result, fmt.Errorf("%s has more columns than the %d placeholders of a statement", s.Name, r.dialect.MaxPlaceholders())
+	}
+	// Hooks run once, a replayed transaction must insert the same IDs.
+	for _, val := range arr {
+		if err := beforeCreate(db, val); err != nil {
+			return result, err
+		}
+	}
+
+	suffix := onConflict(s)
+	returning := suffix != "" && r.dialect.SupportsReturning() && s.PrioritizedPrimaryField != nil
+	if returning {
+		suffix += " " + r.dialect.ReturningClause(s.PrioritizedPrimaryField.DBName)
+	}
+	statements := (len(arr) + rowsPerStatement - 1) / rowsPerStatement
+	err = r.inTx(ctx, statements, func(ctx context.Context) error {
+		result = repository.BulkResult{}
+		db := r.GetDB(ctx)
+		for start := 0; start < len(arr); start += rowsPerStatement {
+			end := start + rowsPerStatement
+			if end > len(arr) {
+				end = len(arr)
+			}
+			var valueStrings []string
+			var valueArgs []interface{}
+			for _, val := range arr[start:end] {
+				rv := redirectReflectPtrToElem(reflect.ValueOf(val))
+				valueKeys := make([]string, len(fields))
+				for i, field := range fields {
+					valueKeys[i] = "?"
+					value, _ := field.ValueOf(ctx, rv)
+					valueArgs = append(valueArgs, value)
+				}
+				valueStrings = append(valueStrings, strings.Join(valueKeys, ","))
+			}
+			sql := fmt.Sprintf(
+				"INSERT INTO %s (%s) VALUES (%s)",
+				r.dialect.Quote(s.Table),
+				strings.Join(columns, ","),
+				strings.Join(valueStrings, "),("))
+			if suffix != "" {
+				sql += " " + suffix
+			}
+
+			if returning {
+				ids, err := queryIDs(db, sql, valueArgs)
+				if err != nil {
+					return err
+				}
+				result.RowsAffected += int64(len(ids))
+				result.IDs = append(result.IDs, ids...)
+				continue
+			}
+			exec := db.Exec(sql, valueArgs...)
+			if exec.Error != nil {
+				return exec.Error
+			}
+			result.RowsAffected += exec.RowsAffected
+			for _, val := range arr[start:end] {
+				result.IDs = append(result.IDs, val.GetID())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return repository.BulkResult{}, err
+	}
+	return result, nil
+}
+
+// BulkUpdate updates columns of arr by primary key, every column but the key
+// and creation ones when columns is empty, with one UPDATE per row. The IDs
+// are those of the rows changed: MySQL and MariaDB leave out the rows that
+// already held the values, Postgres counts every row found. Versioned
+// models are updated as by Updates, a stale one fails the whole update with
+// repository.ErrStaleRecord.
+func (r *BaseRepo) BulkUpdate(ctx context.Context, arr []model.Model, columns ...string) (repository.BulkResult, error) {
+	var result repository.BulkResult
+	if len(arr) == 0 {
+		return result, nil
+	}
+	if len(columns) == 0 {
+		s, err := parseSchema(r.GetDB(ctx), arr[0])
+		if err != nil {
+			return result, err
+		}
+		columns = updatableColumns(s, nil)
+	}
+	// A replayed or failed transaction must not keep the versions it moved to.
+	versions := map[model.Versioned]int64{}
+	for _, val := range arr {
+		if versioned, ok := val.(model.Versioned); ok {
+			versions[versioned] = versioned.GetVersion()
+		}
+	}
+	resetVersions := func() {
+		for versioned, version := range versions {
+			versioned.SetVersion(version)
+		}
+	}
+	err := r.inTx(ctx, len(arr), func(ctx context.Context) error {
+		resetVersions()
+		result = repository.BulkResult{}
+		db := r.GetDB(ctx)
+		for _, val := range arr {
+			q := db.Model(val).Select(columns)
+			if versioned, ok := val.(model.Versioned); ok {
+				// Without error the row of val was updated.
+				if err := r.updateVersion(q, versioned, val); err != nil {
+					return err
+				}
+				result.RowsAffected++
+				result.IDs = append(result.IDs, val.GetID())
+				continue
+			}
+			tx := q.Updates(val)
+			if tx.Error != nil {
+				return tx.Error
+			}
+			if tx.RowsAffected > 0 {
+				result.RowsAffected += tx.RowsAffected
+				result.IDs = append(result.IDs, val.GetID())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		resetVersions()
+		return repository.BulkResult{}, err
+	}
+	return result, nil
+}
+
+// inTx runs fn in a transaction when it takes more than one statement and
+// ctx does not carry a transaction already.
+func (r *BaseRepo) inTx(ctx context.Context, statements int, fn func(ctx context.Context) error) error {
+	if statements <= 1 {
+		return fn(ctx)
+	}
+	return transaction.NewTxManager(r.GetDB(ctx)).RunInTx(ctx, fn)
+}
+
+func queryIDs(db *gorm.DB, sql string, args []interface{}) ([]string, error) {
+	rows, err := db.Raw(sql, args...).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// updatableColumns lists the columns of s an update may overwrite, leaving
+// out the primary keys, the creation time and except.
+func updatableColumns(s *schema.Schema, except []string) []string {
+	var columns []string
+	for _, field := range s.Fields {
+		if field.DBName == "" || !field.Updatable || field.PrimaryKey || field.AutoCreateTime > 0 || contains(except, field.DBName) {
+			continue
+		}
+		columns = append(columns, field.DBName)
+	}
+	return columns
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// beforeCreate runs the hook on its own statement so that the columns it
+// sets, e.g. the id, land in val.
+func beforeCreate(db *gorm.DB, val model.Model) error {
+	tx := db.Session(&gorm.Session{NewDB: true}).Model(val)
+	if err := tx.Statement.Parse(val); err != nil {
+		return err
+	}
+	tx.Statement.Dest = val
+	tx.Statement.ReflectValue = redirectReflectPtrToElem(reflect.ValueOf(val))
+	if err := val.BeforeCreate(tx); err != nil {
+		return err
+	}
+	return tx.Error
+}
+
+// schemaOf parses the model of val, a model, a slice of models or a pointer
+// to either.
+func (r *BaseRepo) schemaOf(val interface{}) (*schema.Schema, error) {
+	return schema.Parse(val, r.schemas, r.namer)
+}
+
+func parseSchema(db *gorm.DB, m interface{}) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(m); err != nil {
+		return nil, err
+	}
+	return stmt.Schema, nil
+}
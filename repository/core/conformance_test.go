@@ -0,0 +1,764 @@
+package core_test
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/best-expendables-v2/common-utils/model"
+	"github.com/best-expendables-v2/common-utils/repository"
+	"github.com/best-expendables-v2/common-utils/repository/core"
+	"github.com/best-expendables-v2/common-utils/repository/filter"
+	"github.com/best-expendables-v2/common-utils/repository/mariadb"
+	"github.com/best-expendables-v2/common-utils/repository/postgresql"
+	"github.com/best-expendables-v2/common-utils/statemachine"
+	"github.com/best-expendables-v2/common-utils/transaction"
+	userclient "github.com/best-expendables-v2/user-service-client"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type product struct {
+	model.BaseModel
+	Name  string
+	Price int
+}
+
+// ConformanceTestSuite runs the same scenarios against every dialect. SQL is
+// written with double quotes and $n placeholders and rewritten per dialect.
+type ConformanceTestSuite struct {
+	suite.Suite
+	dialect   core.Dialect
+	dialector func(conn gorm.ConnPool) gorm.Dialector
+	newRepo   func(db *gorm.DB) repository.BaseRepo
+
+	db   *gorm.DB
+	repo repository.BaseRepo
+	mock sqlmock.Sqlmock
+}
+
+func TestPostgresConformance(t *testing.T) {
+	suite.Run(t, &ConformanceTestSuite{
+		dialect: postgresql.Dialect{},
+		dialector: func(conn gorm.ConnPool) gorm.Dialector {
+			return postgres.New(postgres.Config{Conn: conn})
+		},
+		newRepo: func(db *gorm.DB) repository.BaseRepo { return postgresql.NewBaseRepo(db) },
+	})
+}
+
+func TestMariaDBConformance(t *testing.T) {
+	suite.Run(t, &ConformanceTestSuite{
+		dialect: mariadb.Dialect{},
+		dialector: func(conn gorm.ConnPool) gorm.Dialector {
+			return mysql.New(mysql.Config{Conn: conn, SkipInitializeWithVersion: true})
+		},
+		newRepo: func(db *gorm.DB) repository.BaseRepo { return mariadb.NewBaseRepo(db) },
+	})
+}
+
+func (s *ConformanceTestSuite) SetupTest() {
+	rawDB, mock, err := sqlmock.New()
+	s.Require().NoError(err)
+	s.db, err = gorm.Open(s.dialector(rawDB), &gorm.Config{SkipDefaultTransaction: true})
+	s.Require().NoError(err)
+	s.mock = mock
+	s.repo = s.newRepo(s.db)
+}
+
+func (s *ConformanceTestSuite) TearDownTest() {
+	s.NoError(s.mock.ExpectationsWereMet())
+}
+
+var (
+	quotedPattern      = regexp.MustCompile(`"([^"]+)"`)
+	placeholderPattern = regexp.MustCompile(`\$\d+`)
+)
+
+// sql turns a Postgres flavoured statement into a regexp for the dialect.
+func (s *ConformanceTestSuite) sql(query string) string {
+	query = quotedPattern.ReplaceAllStringFunc(query, func(quoted string) string {
+		return s.dialect.Quote(strings.Trim(quoted, `"`))
+	})
+	if s.dialect.Name() != "postgres" {
+		query = placeholderPattern.ReplaceAllString(query, "?")
+	}
+	return regexp.QuoteMeta(query)
+}
+
+func (s *ConformanceTestSuite) TestFindByID() {
+	s.mock.ExpectQuery(s.sql(`SELECT * FROM "products" WHERE id = $1`)).WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow("1", "book"))
+	s.mock.ExpectQuery(s.sql(`SELECT * FROM "products" WHERE id = $1`)).WithArgs("2").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+
+	var p product
+	s.NoError(s.repo.FindByID(context.Background(), &p, "1"))
+	s.Equal("book", p.Name)
+	s.Equal(repository.RecordNotFound, s.repo.FindByID(context.Background(), &product{}, "2"))
+}
+
+func (s *ConformanceTestSuite) TestSearchAndCount() {
+	f := filter.NewPaginationFilter()
+	f.PerPage = 10
+	f.AddWhere("price", "price > ?", 5)
+	f.AddOrWhereGroup("name", "name = ?", "book")
+
+	s.mock.ExpectQuery(s.sql(`SELECT count(*) FROM "products" WHERE price > $1 OR name = $2`)).
+		WithArgs(5, "book").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(11))
+	s.mock.ExpectQuery(s.sql(`SELECT * FROM "products" WHERE price > $1 OR name = $2 LIMIT 10`)).
+		WithArgs(5, "book").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1").AddRow("2"))
+
+	var products []product
+	count, err := s.repo.SearchAndCount(context.Background(), &products, f)
+	s.NoError(err)
+	s.Equal(int64(11), count)
+	s.Len(products, 2)
+}
+
+func (s *ConformanceTestSuite) TestSearchUnscoped() {
+	s.mock.ExpectQuery(s.sql(`SELECT * FROM "products"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	var products []product
+	s.NoError(s.repo.Search(filter.SetUnscoped(context.Background()), &products, filter.NewPaginationFilter()))
+}
+
+func (s *ConformanceTestSuite) TestCreateAndUpdateInTransaction() {
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(s.sql(`INSERT INTO "products"`)).WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectExec(s.sql(`UPDATE "products" SET `)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	p := &product{Name: "book"}
+	err := transaction.NewTxManager(s.db).RunInTx(context.Background(), func(ctx context.Context) error {
+		if err := s.repo.Create(ctx, p); err != nil {
+			return err
+		}
+		return s.repo.Updates(ctx, p, map[string]interface{}{"name": "pen"})
+	})
+	s.NoError(err)
+	s.NotEmpty(p.Id)
+}
+
+func (s *ConformanceTestSuite) TestDeleteByID() {
+	s.mock.ExpectQuery(s.sql(`SELECT * FROM "products" WHERE id = $1`)).WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1"))
+	s.mock.ExpectExec(s.sql(`DELETE FROM "products" WHERE id = $1 AND "products"."id" = $2`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectQuery(s.sql(`SELECT * FROM "products" WHERE id = $1`)).WithArgs("2").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	s.NoError(s.repo.DeleteByID(context.Background(), &product{}, "1"))
+	s.Equal(repository.RecordNotFound, s.repo.DeleteByID(context.Background(), &product{}, "2"))
+}
+
+func (s *ConformanceTestSuite) TestBulkCreate() {
+	s.mock.ExpectExec(s.sql(`INSERT INTO "products" ("id","created_at","updated_at","name","price") VALUES ($1,$2,$3,$4,$5),($6,$7,$8,$9,$10)`)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	products := []model.Model{
+		&product{BaseModel: model.BaseModel{Id: "1"}, Name: "book"},
+		&product{Name: "pen"},
+	}
+	s.NoError(s.repo.(interface {
+		BulkCreate(ctx context.Context, arr []model.Model) error
+	}).BulkCreate(context.Background(), products))
+	s.NotEmpty(products[1].GetID())
+	s.False(products[1].(*product).CreatedAt.IsZero())
+}
+
+// limitedDialect lowers the placeholders of a statement to test chunking.
+type limitedDialect struct {
+	core.Dialect
+	maxPlaceholders int
+}
+
+func (d limitedDialect) MaxPlaceholders() int {
+	return d.maxPlaceholders
+}
+
+func (s *ConformanceTestSuite) TestBulkInsertInChunks() {
+	insert := s.sql(`INSERT INTO "products" ("id","created_at","updated_at","name","price") VALUES `)
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(insert + `\(.*\),\(.*\)$`).WillReturnResult(sqlmock.NewResult(0, 2))
+	s.mock.ExpectExec(insert + `\([^()]*\)$`).WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	repo := core.NewBaseRepo(s.db, limitedDialect{Dialect: s.dialect, maxPlaceholders: 10})
+	products := []model.Model{&product{Name: "book"}, &product{Name: "pen"}, &product{Name: "ink"}}
+	result, err := repo.BulkInsert(context.Background(), products)
+	s.NoError(err)
+	s.Equal(int64(3), result.RowsAffected)
+	s.Equal([]string{products[0].GetID(), products[1].GetID(), products[2].GetID()}, result.IDs)
+}
+
+func (s *ConformanceTestSuite) TestBulkInsertTooManyColumns() {
+	repo := core.NewBaseRepo(s.db, limitedDialect{Dialect: s.dialect, maxPlaceholders: 4})
+	_, err := repo.BulkInsert(context.Background(), []model.Model{&product{Name: "book"}})
+	s.Error(err)
+}
+
+func (s *ConformanceTestSuite) TestBulkUpsert() {
+	insert := `INSERT INTO "products" ("id","created_at","updated_at","name","price") VALUES ($1,$2,$3,$4,$5) `
+	upsert := s.dialect.UpsertClause([]string{"name"}, []string{"updated_at", "price"})
+	if s.dialect.SupportsReturning() {
+		s.mock.ExpectQuery(s.sql(insert) + regexp.QuoteMeta(upsert+" "+s.dialect.ReturningClause("id"))).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("existing"))
+	} else {
+		s.mock.ExpectExec(s.sql(insert) + regexp.QuoteMeta(upsert)).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+	}
+
+	products := []model.Model{&product{Name: "book", Price: 5}}
+	result, err := s.repo.(repository.BulkWritable).BulkUpsert(context.Background(), products, []string{"name"})
+	s.NoError(err)
+	if s.dialect.SupportsReturning() {
+		s.Equal(repository.BulkResult{RowsAffected: 1, IDs: []string{"existing"}}, result)
+	} else {
+		s.Equal(repository.BulkResult{RowsAffected: 2, IDs: []string{products[0].GetID()}}, result)
+	}
+}
+
+func (s *ConformanceTestSuite) TestBulkUpdate() {
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(s.sql(`UPDATE "products" SET `) + `.*` + s.sql(`WHERE "id" = $4`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectExec(s.sql(`UPDATE "products" SET `) + `.*` + s.sql(`WHERE "id" = $4`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectCommit()
+
+	products := []model.Model{
+		&product{BaseModel: model.BaseModel{Id: "1"}, Name: "book"},
+		&product{BaseModel: model.BaseModel{Id: "2"}, Name: "pen"},
+	}
+	result, err := s.repo.(repository.BulkWritable).BulkUpdate(context.Background(), products)
+	s.NoError(err)
+	s.Equal(repository.BulkResult{RowsAffected: 1, IDs: []string{"1"}}, result)
+}
+
+func (s *ConformanceTestSuite) TestDialect() {
+	s.Equal(s.dialect.Quote("shop")+"."+s.dialect.Quote("products"), s.dialect.Quote("shop.products"))
+	s.Contains(s.dialect.UpsertClause([]string{"id"}, []string{"name"}), s.dialect.Quote("name"))
+	s.Equal(s.dialect.SupportsReturning(), s.dialect.ReturningClause("id") != "")
+	s.Greater(s.dialect.MaxPlaceholders(), 0)
+}
+
+var cursorSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func (s *ConformanceTestSuite) TestSearchPage() {
+	newFilter := func() *filter.CursorFilter {
+		f, err := filter.NewCursorFilter(cursorSecret, map[string]string{"price": "price"})
+		s.Require().NoError(err)
+		f.PerPage = 2
+		f.OrderBy = []string{"price desc"}
+		return f
+	}
+	searchPage := s.repo.(repository.CanSearchPage).SearchPage
+
+	s.mock.ExpectQuery(s.sql(`SELECT * FROM "products" ORDER BY price DESC,"products"."id" DESC LIMIT 3`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "price"}).AddRow("3", 30).AddRow("2", 20).AddRow("1", 20))
+
+	var products []product
+	page, err := searchPage(context.Background(), &products, newFilter())
+	s.NoError(err)
+	s.Len(products, 2)
+	s.Equal("2", products[1].Id)
+	s.NotEmpty(page.NextCursor)
+	s.Empty(page.PrevCursor)
+
+	s.mock.ExpectQuery(s.sql(`SELECT * FROM "products" WHERE ((price < $1) OR (price = $2 AND "products"."id" < $3)) ORDER BY price DESC,"products"."id" DESC LIMIT 3`)).
+		WithArgs(20, 20, "2").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "price"}).AddRow("1", 20))
+
+	f := newFilter()
+	f.Cursor = page.NextCursor
+	products = nil
+	page, err = searchPage(context.Background(), &products, f)
+	s.NoError(err)
+	s.Len(products, 1)
+	s.Empty(page.NextCursor)
+	s.NotEmpty(page.PrevCursor)
+
+	s.mock.ExpectQuery(s.sql(`SELECT * FROM "products" WHERE ((price > $1) OR (price = $2 AND "products"."id" > $3)) ORDER BY price,"products"."id" LIMIT 3`)).
+		WithArgs(20, 20, "1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "price"}).AddRow("2", 20).AddRow("3", 30))
+
+	f = newFilter()
+	f.Cursor = page.PrevCursor
+	products = nil
+	page, err = searchPage(context.Background(), &products, f)
+	s.NoError(err)
+	s.Equal([]string{"3", "2"}, []string{products[0].Id, products[1].Id})
+	s.NotEmpty(page.NextCursor)
+	s.Empty(page.PrevCursor)
+
+	f = newFilter()
+	f.Cursor = "tampered"
+	_, err = searchPage(context.Background(), &products, f)
+	s.Equal(filter.ErrInvalidCursor, err)
+}
+
+func (s *ConformanceTestSuite) TestSearchPageWithOrGroup() {
+	newFilter := func() *filter.CursorFilter {
+		f, err := filter.NewCursorFilter(cursorSecret, nil)
+		s.Require().NoError(err)
+		f.PerPage = 1
+		f.AddWhere("price", "price > ?", 5)
+		f.AddOrWhereGroup("name", "name = ?", "book")
+		return f
+	}
+	searchPage := s.repo.(repository.CanSearchPage).SearchPage
+
+	s.mock.ExpectQuery(s.sql(`SELECT * FROM "products" WHERE (price > $1 OR name = $2) ORDER BY "products"."id" LIMIT 2`)).
+		WithArgs(5, "book").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow("1", "book").AddRow("2", "pen"))
+	s.mock.ExpectQuery(s.sql(`SELECT * FROM "products" WHERE (price > $1 OR name = $2) AND (("products"."id" > $3)) ORDER BY "products"."id" LIMIT 2`)).
+		WithArgs(5, "book", "1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow("2", "pen"))
+
+	var products []product
+	page, err := searchPage(context.Background(), &products, newFilter())
+	s.NoError(err)
+	s.NotEmpty(page.NextCursor)
+
+	f := newFilter()
+	f.Cursor = page.NextCursor
+	products = nil
+	page, err = searchPage(context.Background(), &products, f)
+	s.NoError(err)
+	s.Equal("pen", products[0].Name)
+	s.Empty(page.NextCursor)
+}
+
+func (s *ConformanceTestSuite) TestSearchPageWithJoin() {
+	f, err := filter.NewCursorFilter(cursorSecret, nil)
+	s.Require().NoError(err)
+	f.AddJoin("JOIN categories ON categories.id = products.category_id")
+	f.PerPage = 1
+
+	s.mock.ExpectQuery(s.sql(`FROM "products" JOIN categories ON categories.id = products.category_id ORDER BY "products"."id" LIMIT 2`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1"))
+
+	var products []product
+	_, err = s.repo.(repository.CanSearchPage).SearchPage(context.Background(), &products, f)
+	s.NoError(err)
+}
+
+type discountedProduct struct {
+	model.BaseModel
+	Discount *int
+}
+
+func (s *ConformanceTestSuite) TestSearchPageNullableColumn() {
+	f, err := filter.NewCursorFilter(cursorSecret, map[string]string{"discount": "discount"})
+	s.Require().NoError(err)
+	f.OrderBy = []string{"discount asc"}
+
+	var products []discountedProduct
+	_, err = s.repo.(repository.CanSearchPage).SearchPage(context.Background(), &products, f)
+	s.EqualError(err, "cursor column discount of discountedProduct can be NULL, tag it not null")
+}
+
+type versionedProduct struct {
+	model.BaseModel
+	model.VersionedModel
+	Name string
+}
+
+func (s *ConformanceTestSuite) TestUpdatesVersioned() {
+	s.mock.ExpectExec(s.sql(`UPDATE "versioned_products" SET "updated_at"=$1,"name"=$2 ,"version" = "version" + 1 WHERE "versioned_products"."version" = $3 AND "id" = $4`)).
+		WithArgs(sqlmock.AnyArg(), "pen", 3, "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectExec(s.sql(`UPDATE "versioned_products" SET "updated_at"=$1,"name"=$2 ,"version" = "version" + 1 WHERE "versioned_products"."version" = $3 AND "id" = $4`)).
+		WithArgs(sqlmock.AnyArg(), "ink", 4, "1").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	p := &versionedProduct{BaseModel: model.BaseModel{Id: "1"}, VersionedModel: model.VersionedModel{Version: 3}}
+	s.NoError(s.repo.Updates(context.Background(), p, map[string]interface{}{"name": "pen", "version": 10}))
+	s.Equal(int64(4), p.Version)
+	s.Equal(repository.ErrStaleRecord, s.repo.Update(context.Background(), p, "name", "ink"))
+	s.Equal(int64(4), p.Version)
+}
+
+func (s *ConformanceTestSuite) TestBulkUpdateVersioned() {
+	update := s.sql(`UPDATE "versioned_products" SET "updated_at"=$1,"name"=$2 ,"version" = "version" + 1 WHERE "versioned_products"."version" = $3 AND "id" = $4`)
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(update).WithArgs(sqlmock.AnyArg(), "book", 3, "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectExec(update).WithArgs(sqlmock.AnyArg(), "pen", 7, "2").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectRollback()
+
+	book := &versionedProduct{BaseModel: model.BaseModel{Id: "1"}, VersionedModel: model.VersionedModel{Version: 3}, Name: "book"}
+	pen := &versionedProduct{BaseModel: model.BaseModel{Id: "2"}, VersionedModel: model.VersionedModel{Version: 7}, Name: "pen"}
+	bulk := s.repo.(repository.BulkWritable)
+	_, err := bulk.BulkUpdate(context.Background(), []model.Model{book, pen}, "name", "version")
+	s.Equal(repository.ErrStaleRecord, err)
+	s.Equal(int64(3), book.Version)
+
+	_, err = bulk.BulkUpsert(context.Background(), []model.Model{book}, []string{"id"})
+	s.Equal(repository.ErrVersionedUpsert, err)
+}
+
+func (s *ConformanceTestSuite) TestSaveVersioned() {
+	s.mock.ExpectExec(s.sql(`UPDATE "versioned_products" SET "created_at"=$1,"updated_at"=$2,"name"=$3 ,"version" = "version" + 1 WHERE "versioned_products"."version" = $4 AND "id" = $5`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "pen", 0, "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	s.mock.ExpectExec(s.sql(`UPDATE "versioned_products" SET "created_at"=$1,"updated_at"=$2,"name"=$3 ,"version" = "version" + 1 WHERE "versioned_products"."version" = $4 AND "id" = $5`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "ink", 0, "2").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	p := &versionedProduct{BaseModel: model.BaseModel{Id: "1"}, Name: "pen"}
+	s.NoError(s.repo.Save(context.Background(), p))
+	s.Equal(int64(1), p.Version)
+	// A preassigned id without a row is not inserted.
+	s.Equal(repository.ErrStaleRecord, s.repo.Save(context.Background(), &versionedProduct{BaseModel: model.BaseModel{Id: "2"}, Name: "ink"}))
+}
+
+// versionedTag has no column gorm updates on every write.
+type versionedTag struct {
+	ID string `gorm:"primaryKey"`
+	model.VersionedModel
+	Name string
+}
+
+func (t *versionedTag) GetID() string               { return t.ID }
+func (t *versionedTag) BeforeCreate(*gorm.DB) error { return nil }
+func (t *versionedTag) BeforeUpdate(*gorm.DB) error { return nil }
+func (t *versionedTag) RevisionKey() string         { return t.ID }
+
+func (s *ConformanceTestSuite) TestBulkUpdateVersionedCountsUpdatedRows() {
+	update := s.sql(`UPDATE "versioned_tags" SET "id"="id" ,"version" = "version" + 1 WHERE "versioned_tags"."version" = $1 AND "id" = $2`)
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(update).WithArgs(3, "1").WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectExec(update).WithArgs(5, "2").WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+
+	// Only the version is selected, the statements still check and move it.
+	first := &versionedTag{ID: "1", VersionedModel: model.VersionedModel{Version: 3}}
+	second := &versionedTag{ID: "2", VersionedModel: model.VersionedModel{Version: 5}}
+	result, err := s.repo.(repository.BulkWritable).BulkUpdate(context.Background(), []model.Model{first, second}, "version")
+	s.NoError(err)
+	s.Equal(repository.BulkResult{RowsAffected: 2, IDs: []string{"1", "2"}}, result)
+	s.Equal(int64(4), first.Version)
+}
+
+type order struct {
+	model.BaseModel
+	Status string
+}
+
+func (o *order) GetStatus() string {
+	return o.Status
+}
+
+func (o *order) SetStatus(status string) {
+	o.Status = status
+}
+
+// transitionRepo looks the state machines up in registry.
+func (s *ConformanceTestSuite) transitionRepo(registry *statemachine.Registry) repository.Transitionable {
+	s.repo.(interface {
+		SetStateMachines(registry *statemachine.Registry)
+	}).SetStateMachines(registry)
+	return s.repo.(repository.Transitionable)
+}
+
+func (s *ConformanceTestSuite) TestTransition() {
+	var after []string
+	registry := statemachine.NewRegistry()
+	registry.Register(&order{}, statemachine.New([]statemachine.Transition{
+		{
+			From: []string{"pending"},
+			To:   "paid",
+			After: []statemachine.AfterHook{func(ctx context.Context, m model.Stateful, from, to string) {
+				after = append(after, from+"->"+to)
+			}},
+		},
+		{
+			From: []string{"paid"},
+			To:   "shipped",
+			Guards: []statemachine.Hook{func(ctx context.Context, m model.Stateful, from, to string) error {
+				return repository.TransitionNotApplicable
+			}},
+		},
+	}, statemachine.WithHistory("order_transitions")))
+
+	update := s.sql(`UPDATE "orders" SET "updated_at"=$1,"status"=$2 WHERE "orders"."status" = $3 AND "id" = $4`)
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(update).WithArgs(sqlmock.AnyArg(), "paid", "pending", "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectExec(s.sql(`INSERT INTO "order_transitions" ("id","created_at","updated_at","entity_type","entity_id","from_status","to_status")`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "orders", "1", "pending", "paid").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(update).WithArgs(sqlmock.AnyArg(), "paid", "pending", "2").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectRollback()
+	s.mock.ExpectBegin()
+	s.mock.ExpectRollback()
+
+	o := &order{BaseModel: model.BaseModel{Id: "1"}, Status: "pending"}
+	transitionable := s.transitionRepo(registry)
+	s.NoError(transitionable.Transition(context.Background(), o, "paid"))
+	s.Equal("paid", o.Status)
+	s.Equal([]string{"pending->paid"}, after)
+
+	concurrent := &order{BaseModel: model.BaseModel{Id: "2"}, Status: "pending"}
+	s.Equal(repository.TransitionNotApplicable, transitionable.Transition(context.Background(), concurrent, "paid"))
+	s.Equal("pending", concurrent.Status)
+
+	s.Equal(repository.TransitionNotApplicable, transitionable.Transition(context.Background(), o, "shipped"))
+	s.Equal(repository.TransitionNotApplicable, transitionable.Transition(context.Background(), o, "pending"))
+	s.Equal([]string{"pending->paid"}, after)
+}
+
+type versionedOrder struct {
+	model.BaseModel
+	model.VersionedModel
+	Status string
+}
+
+func (o *versionedOrder) GetStatus() string {
+	return o.Status
+}
+
+func (o *versionedOrder) SetStatus(status string) {
+	o.Status = status
+}
+
+func (s *ConformanceTestSuite) TestTransitionVersioned() {
+	registry := statemachine.NewRegistry()
+	registry.Register(&versionedOrder{}, statemachine.New([]statemachine.Transition{
+		{From: []string{"pending"}, To: "paid"},
+	}))
+
+	update := s.sql(`UPDATE "versioned_orders" SET "updated_at"=$1,"status"=$2 ,"version" = "version" + 1 WHERE "versioned_orders"."status" = $3 AND "versioned_orders"."version" = $4 AND "id" = $5`)
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(update).WithArgs(sqlmock.AnyArg(), "paid", "pending", 2, "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectCommit()
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(update).WithArgs(sqlmock.AnyArg(), "paid", "pending", 2, "2").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectRollback()
+
+	transitionable := s.transitionRepo(registry)
+	o := &versionedOrder{BaseModel: model.BaseModel{Id: "1"}, VersionedModel: model.VersionedModel{Version: 2}, Status: "pending"}
+	s.NoError(transitionable.Transition(context.Background(), o, "paid"))
+	s.Equal(int64(3), o.Version)
+
+	stale := &versionedOrder{BaseModel: model.BaseModel{Id: "2"}, VersionedModel: model.VersionedModel{Version: 2}, Status: "pending"}
+	s.Equal(repository.ErrStaleRecord, transitionable.Transition(context.Background(), stale, "paid"))
+	s.Equal("pending", stale.Status)
+	s.Equal(int64(2), stale.Version)
+}
+
+type softOrder struct {
+	model.BaseModel
+	model.SoftDeletableModel
+	Items []softItem `gorm:"foreignKey:OrderID"`
+}
+
+func (o *softOrder) SoftDeleteCascade() []string {
+	return []string{"Items"}
+}
+
+type softItem struct {
+	model.BaseModel
+	model.SoftDeletableModel
+	OrderID string
+}
+
+func (s *ConformanceTestSuite) TestSoftDelete() {
+	ctx := userclient.ContextWithUser(context.Background(), &userclient.User{Id: "u1"})
+	s.mock.ExpectQuery(s.sql(`SELECT * FROM "soft_orders" WHERE id = $1 AND "soft_orders"."deleted_at" IS NULL`)).
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1"))
+	s.mock.ExpectBegin()
+	s.mock.ExpectExec(s.sql(`UPDATE "soft_orders" SET "deleted_at"=$1 ,"deleted_by" = $2 WHERE "soft_orders"."id" = $3 AND "soft_orders"."deleted_at" IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), "u1", "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectExec(s.sql(`UPDATE "soft_items" SET "deleted_at"=$1 ,"deleted_by" = $2 WHERE "soft_items"."order_id" = $3 AND "soft_items"."deleted_at" IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), "u1", "1").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	s.mock.ExpectCommit()
+
+	o := &softOrder{}
+	s.NoError(s.repo.DeleteByID(ctx, o, "1"))
+	s.True(o.IsDeleted())
+	s.Equal("u1", o.DeletedBy)
+}
+
+func (s *ConformanceTestSuite) TestRestoreAndForceDelete() {
+	s.mock.ExpectQuery(s.sql(`SELECT * FROM "soft_orders" WHERE id = $1 AND deleted_at IS NOT NULL`)).
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "deleted_at", "deleted_by"}).AddRow("1", time.Now(), "u1"))
+	s.mock.ExpectExec(s.sql(`UPDATE "soft_orders" SET "updated_at"=$1,"deleted_at"=$2,"deleted_by"=$3 WHERE "id" = $4`)).
+		WithArgs(sqlmock.AnyArg(), nil, "", "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectQuery(s.sql(`SELECT * FROM "soft_orders" WHERE id = $1 AND deleted_at IS NOT NULL`)).
+		WithArgs("2").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	s.mock.ExpectQuery(s.sql(`SELECT * FROM "soft_orders" WHERE id = $1`)).
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1"))
+	s.mock.ExpectExec(s.sql(`DELETE FROM "soft_orders" WHERE "soft_orders"."id" = $1`)).
+		WithArgs("1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	removable := s.repo.(repository.SoftRemovable)
+	o := &softOrder{}
+	s.NoError(removable.Restore(context.Background(), o, "1"))
+	s.False(o.IsDeleted())
+	s.Equal(repository.RecordNotFound, removable.Restore(context.Background(), &softOrder{}, "2"))
+	s.Equal(repository.ErrNotSoftDeletable, removable.Restore(context.Background(), &product{}, "1"))
+	s.NoError(removable.ForceDelete(context.Background(), &softOrder{}, "1"))
+}
+
+type hardItem struct {
+	model.BaseModel
+	OrderID string
+}
+
+type cascadingOrder struct {
+	model.BaseModel
+	model.SoftDeletableModel
+	Items []hardItem `gorm:"foreignKey:OrderID"`
+}
+
+func (o *cascadingOrder) SoftDeleteCascade() []string {
+	return []string{"Items"}
+}
+
+func (s *ConformanceTestSuite) TestSoftDeleteCascadeToHardDeletable() {
+	s.mock.ExpectQuery(s.sql(`SELECT * FROM "cascading_orders" WHERE id = $1 AND "cascading_orders"."deleted_at" IS NULL`)).
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1"))
+	s.mock.ExpectBegin()
+	s.mock.ExpectRollback()
+
+	err := s.repo.DeleteByID(context.Background(), &cascadingOrder{}, "1")
+	s.ErrorIs(err, repository.ErrNotSoftDeletable)
+}
+
+type versionedSoftOrder struct {
+	model.BaseModel
+	model.SoftDeletableModel
+	model.VersionedModel
+}
+
+func (s *ConformanceTestSuite) TestRestoreVersioned() {
+	restore := s.sql(`UPDATE "versioned_soft_orders" SET "updated_at"=$1,"deleted_at"=$2,"deleted_by"=$3 ,"version" = "version" + 1 WHERE "versioned_soft_orders"."version" = $4 AND "id" = $5`)
+	s.mock.ExpectQuery(s.sql(`SELECT * FROM "versioned_soft_orders" WHERE id = $1 AND deleted_at IS NOT NULL`)).
+		WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "deleted_by", "version"}).AddRow("1", "u1", 4))
+	s.mock.ExpectExec(restore).WithArgs(sqlmock.AnyArg(), nil, "", 4, "1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	s.mock.ExpectQuery(s.sql(`SELECT * FROM "versioned_soft_orders" WHERE id = $1 AND deleted_at IS NOT NULL`)).
+		WithArgs("2").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "deleted_by", "version"}).AddRow("2", "u1", 4))
+	s.mock.ExpectExec(restore).WithArgs(sqlmock.AnyArg(), nil, "", 4, "2").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	removable := s.repo.(repository.SoftRemovable)
+	o := &versionedSoftOrder{}
+	s.NoError(removable.Restore(context.Background(), o, "1"))
+	s.Equal(int64(5), o.Version)
+	s.Equal(repository.ErrStaleRecord, removable.Restore(context.Background(), &versionedSoftOrder{}, "2"))
+}
+
+func (s *ConformanceTestSuite) TestPurgeDeletedBefore() {
+	before := time.Now().Add(-24 * time.Hour)
+	s.mock.ExpectQuery(s.sql(`SELECT "id" FROM "soft_orders" WHERE deleted_at IS NOT NULL AND deleted_at < $1 LIMIT 1000`)).
+		WithArgs(before).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1").AddRow("2"))
+	s.mock.ExpectExec(s.sql(`DELETE FROM "soft_orders" WHERE id IN ($1,$2) AND (deleted_at IS NOT NULL AND deleted_at < $3)`)).
+		WithArgs("1", "2", before).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	removable := s.repo.(repository.SoftRemovable)
+	purged, err := removable.PurgeDeletedBefore(context.Background(), &softOrder{}, before)
+	s.NoError(err)
+	s.Equal(int64(1), purged)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = removable.PurgeDeletedBefore(ctx, &softOrder{}, before)
+	s.Equal(context.Canceled, err)
+	_, err = removable.PurgeDeletedBefore(context.Background(), &product{}, before)
+	s.Equal(repository.ErrNotSoftDeletable, err)
+}
+
+func (s *ConformanceTestSuite) TestIterate() {
+	f := filter.NewPaginationFilter()
+	f.AddWhere("price", "price > ?", 5)
+	f.AddOrWhereGroup("name", "name = ?", "book")
+
+	s.mock.ExpectQuery(s.sql(`SELECT * FROM "products" WHERE (price > $1 OR name = $2) ORDER BY "products"."id" LIMIT 2`)).
+		WithArgs(5, "book").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow("1", "book").AddRow("2", "pen"))
+	s.mock.ExpectQuery(s.sql(`SELECT * FROM "products" WHERE (price > $1 OR name = $2) AND "products"."id" > $3 ORDER BY "products"."id" LIMIT 2`)).
+		WithArgs(5, "book", "2").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow("3", "ink"))
+
+	var names []string
+	var products []product
+	err := s.repo.(repository.Iterable).Iterate(context.Background(), &products, f, 2, func(batch interface{}) error {
+		for _, p := range *batch.(*[]product) {
+			names = append(names, p.Name)
+		}
+		return nil
+	})
+	s.NoError(err)
+	s.Equal([]string{"book", "pen", "ink"}, names)
+}
+
+func (s *ConformanceTestSuite) TestIterateStopsOnCancel() {
+	s.mock.ExpectQuery(s.sql(`SELECT * FROM "products" ORDER BY "products"."id" LIMIT 1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo := repository.NewRepo[product](s.repo)
+	batches := 0
+	err := repo.Iterate(ctx, filter.NewPaginationFilter(), 1, func(batch []product) error {
+		batches++
+		s.Equal("1", batch[0].Id)
+		cancel()
+		return nil
+	})
+	s.Equal(context.Canceled, err)
+	s.Equal(1, batches)
+}
+
+func (s *ConformanceTestSuite) TestRows() {
+	s.mock.ExpectQuery(s.sql(`SELECT * FROM "products" WHERE price > $1 ORDER BY "products"."id"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow("1", "book").AddRow("2", "pen"))
+
+	f := filter.NewPaginationFilter()
+	f.AddWhere("price", "price > ?", 5)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rows, err := s.repo.(repository.Iterable).Rows(ctx, &product{}, f)
+	s.Require().NoError(err)
+	defer rows.Close()
+
+	s.True(rows.Next())
+	var p product
+	s.NoError(rows.Scan(&p))
+	s.Equal("book", p.Name)
+	cancel()
+	s.False(rows.Next())
+	s.Equal(context.Canceled, rows.Err())
+}
@@ -0,0 +1,18 @@
+package core
+
+// Dialect holds what differs between the SQL databases behind a BaseRepo.
+type Dialect interface {
+	Name() string
+	// Quote quotes a table or column name, schema qualified names included.
+	Quote(identifier string) string
+	// UpsertClause turns an INSERT into an update of the existing row when
+	// conflictColumns collide. Databases resolving conflicts through any
+	// unique key ignore conflictColumns.
+	UpsertClause(conflictColumns, updateColumns []string) string
+	SupportsReturning() bool
+	// ReturningClause makes an INSERT or UPDATE return columns, it is empty
+	// when SupportsReturning is false.
+	ReturningClause(columns ...string) string
+	// MaxPlaceholders bounds the bound arguments of a single statement.
+	MaxPlaceholders() int
+}
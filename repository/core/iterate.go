@@ -0,0 +1,108 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+
+	"github.com/best-expendables-v2/common-utils/repository"
+	"github.com/best-expendables-v2/common-utils/repository/filter"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const defaultBatchSize = 500
+
+var _ repository.Iterable = (*BaseRepo)(nil)
+
+// Iterate calls fn with batches of at most batchSize rows matching f, in
+// primary key order. val is a pointer to a slice, refilled for every batch
+// and passed to fn. The pagination and ordering of f are ignored. Each batch
+// is its own keyset query so rows written meanwhile may or may not be seen.
+func (r *BaseRepo) Iterate(ctx context.Context, val interface{}, f filter.Filter, batchSize int, fn func(batch interface{}) error) error {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	s, err := r.schemaOf(val)
+	if err != nil {
+		return err
+	}
+	pk := s.PrioritizedPrimaryField
+	if pk == nil {
+		return errors.New("cannot iterate over " + s.Name + " without a primary key")
+	}
+	column := clause.Column{Table: clause.CurrentTable, Name: pk.DBName}
+
+	rows := reflect.ValueOf(val).Elem()
+	var last interface{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		q := r.groupedFiltered(ctx, val, f)
+		if last != nil {
+			q = q.Where(clause.Gt{Column: column, Value: last})
+		}
+		rows.SetLen(0)
+		if err := q.Order(clause.OrderByColumn{Column: column}).Limit(batchSize).Find(val).Error; err != nil {
+			return err
+		}
+		n := rows.Len()
+		if n == 0 {
+			return nil
+		}
+		last, _ = pk.ValueOf(ctx, reflect.Indirect(rows.Index(n-1)))
+		if err := fn(val); err != nil {
+			return err
+		}
+		if n < batchSize {
+			return nil
+		}
+	}
+}
+
+// Rows streams the rows matching f with a single query, in primary key
+// order. val tells the model, a pointer to it or to a slice of it. The
+// pagination and ordering of f are ignored.
+func (r *BaseRepo) Rows(ctx context.Context, val interface{}, f filter.Filter) (repository.Rows, error) {
+	s, err := r.schemaOf(val)
+	if err != nil {
+		return nil, err
+	}
+	q := r.groupedFiltered(ctx, val, f)
+	if pk := s.PrioritizedPrimaryField; pk != nil {
+		q = q.Order(clause.OrderByColumn{Column: clause.Column{Table: clause.CurrentTable, Name: pk.DBName}})
+	}
+	sqlRows, err := q.Rows()
+	if err != nil {
+		return nil, err
+	}
+	return &rowCursor{ctx: ctx, db: q, rows: sqlRows}, nil
+}
+
+type rowCursor struct {
+	ctx  context.Context
+	db   *gorm.DB
+	rows *sql.Rows
+}
+
+// Next stops as soon as ctx is done, Err then tells why.
+func (r *rowCursor) Next() bool {
+	return r.ctx.Err() == nil && r.rows.Next()
+}
+
+func (r *rowCursor) Scan(dest interface{}) error {
+	return r.db.ScanRows(r.rows, dest)
+}
+
+func (r *rowCursor) Err() error {
+	if err := r.ctx.Err(); err != nil {
+		return err
+	}
+	return r.rows.Err()
+}
+
+func (r *rowCursor) Close() error {
+	return r.rows.Close()
+}
@@ -0,0 +1,159 @@
+package core
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/best-expendables-v2/common-utils/repository/filter"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// SearchPage fills val, a pointer to a slice, with the page of f.Cursor and
+// returns the cursors of the pages around it. The ordered columns must be
+// fields of val that cannot be NULL, keyset conditions cannot compare NULLs.
+func (r *BaseRepo) SearchPage(ctx context.Context, val interface{}, f *filter.CursorFilter, preloadFields ...string) (filter.Page, error) {
+	cursor, err := f.DecodeCursor()
+	if err != nil {
+		return filter.Page{}, err
+	}
+	keys := f.OrderKeys()
+	backward := cursor != nil && cursor.Backward
+	s, err := r.schemaOf(val)
+	if err != nil {
+		return filter.Page{}, err
+	}
+	fields, err := keyFields(s, keys)
+	if err != nil {
+		return filter.Page{}, err
+	}
+	columns := keyColumns(keys, f.GetTieBreaker())
+
+	q := r.groupedFiltered(ctx, val, f)
+	if cursor != nil {
+		query, args := keysetCondition(keys, columns, cursor.Values, backward)
+		q = q.Where(query, args...)
+	}
+	for i, key := range keys {
+		q = q.Order(clause.OrderByColumn{Column: columns[i], Desc: key.Desc != backward})
+	}
+	q = preload(ctx, q.Limit(f.GetLimit()), preloadFields)
+	if err := q.Find(val).Error; err != nil {
+		return filter.Page{}, err
+	}
+
+	rows := reflect.ValueOf(val).Elem()
+	hasMore := rows.Len() > f.GetPerPage()
+	if hasMore {
+		rows.Set(rows.Slice(0, f.GetPerPage()))
+	}
+	if backward {
+		reverse(rows)
+	}
+	if rows.Len() == 0 {
+		return filter.Page{}, nil
+	}
+
+	var page filter.Page
+	// Going forward there is a previous page once a cursor was used, going
+	// backward there is a next page, the one the cursor came from.
+	if hasMore || backward {
+		if page.NextCursor, err = cursorOf(ctx, f, fields, rows.Index(rows.Len()-1), false); err != nil {
+			return filter.Page{}, err
+		}
+	}
+	if (backward && hasMore) || (!backward && cursor != nil) {
+		if page.PrevCursor, err = cursorOf(ctx, f, fields, rows.Index(0), true); err != nil {
+			return filter.Page{}, err
+		}
+	}
+	return page, nil
+}
+
+// keyFields returns the fields of s holding the values of keys.
+func keyFields(s *schema.Schema, keys []filter.OrderKey) ([]*schema.Field, error) {
+	fields := make([]*schema.Field, len(keys))
+	for i, key := range keys {
+		column := key.Column
+		if i := strings.LastIndex(column, "."); i >= 0 {
+			column = column[i+1:]
+		}
+		field := s.LookUpField(column)
+		if field == nil {
+			return nil, fmt.Errorf("cursor column %s is not a field of %s", key.Column, s.Name)
+		}
+		if nullable(field) {
+			return nil, fmt.Errorf("cursor column %s of %s can be NULL, tag it not null", key.Column, s.Name)
+		}
+		fields[i] = field
+	}
+	return fields, nil
+}
+
+// nullable tells whether field may hold NULL: a pointer or a valuer, e.g.
+// sql.NullString, not tagged not null.
+func nullable(field *schema.Field) bool {
+	if field.PrimaryKey || field.NotNull {
+		return false
+	}
+	if field.FieldType.Kind() == reflect.Ptr {
+		return true
+	}
+	_, ok := reflect.Zero(field.FieldType).Interface().(driver.Valuer)
+	return ok
+}
+
+// keyColumns are the columns of keys, the tie-breaker being qualified with
+// the searched table so that joins do not make it ambiguous.
+func keyColumns(keys []filter.OrderKey, tieBreaker string) []clause.Column {
+	columns := make([]clause.Column, len(keys))
+	for i, key := range keys {
+		if key.Column == tieBreaker && !strings.Contains(key.Column, ".") {
+			columns[i] = clause.Column{Table: clause.CurrentTable, Name: key.Column}
+		} else {
+			columns[i] = clause.Column{Name: key.Column, Raw: true}
+		}
+	}
+	return columns
+}
+
+func cursorOf(ctx context.Context, f *filter.CursorFilter, fields []*schema.Field, row reflect.Value, backward bool) (string, error) {
+	values := make([]interface{}, len(fields))
+	for i, field := range fields {
+		values[i], _ = field.ValueOf(ctx, reflect.Indirect(row))
+	}
+	return f.EncodeCursor(values, backward)
+}
+
+// keysetCondition selects the rows after values in the ordering of keys, or
+// before them when backward: (a > ?) OR (a = ? AND b > ?) OR ...
+func keysetCondition(keys []filter.OrderKey, columns []clause.Column, values []interface{}, backward bool) (string, []interface{}) {
+	var ors []string
+	var args []interface{}
+	for i, key := range keys {
+		var ands []string
+		for j := 0; j < i; j++ {
+			ands = append(ands, "? = ?")
+			args = append(args, columns[j], values[j])
+		}
+		operator := ">"
+		if key.Desc != backward {
+			operator = "<"
+		}
+		ands = append(ands, "? "+operator+" ?")
+		args = append(args, columns[i], values[i])
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	return "(" + strings.Join(ors, " OR ") + ")", args
+}
+
+func reverse(rows reflect.Value) {
+	for i, j := 0, rows.Len()-1; i < j; i, j = i+1, j-1 {
+		a, b := rows.Index(i).Interface(), rows.Index(j).Interface()
+		rows.Index(i).Set(reflect.ValueOf(b))
+		rows.Index(j).Set(reflect.ValueOf(a))
+	}
+}
@@ -0,0 +1,129 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/best-expendables-v2/common-utils/model"
+	"github.com/best-expendables-v2/common-utils/repository"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const purgeBatchSize = 1000
+
+var _ repository.SoftRemovable = (*BaseRepo)(nil)
+
+// softDelete marks m and the associations it cascades to as deleted by the
+// actor of ctx, one level deep. Associations must be soft deletable so that
+// Restore leaves nothing lost.
+func (r *BaseRepo) softDelete(ctx context.Context, m model.Model) error {
+	var cascade []string
+	if cascader, ok := m.(model.SoftDeleteCascader); ok {
+		cascade = cascader.SoftDeleteCascade()
+	}
+	actor := model.Actor(ctx)
+	deletedBy := appendAssignment(clause.Expr{SQL: "," + r.dialect.Quote(model.DeletedByColumn) + " = ?", Vars: []interface{}{actor}})
+
+	return r.inTx(ctx, 1+len(cascade), func(ctx context.Context) error {
+		db := r.GetDB(ctx)
+		s, err := parseSchema(db, m)
+		if err != nil {
+			return err
+		}
+		relations := make([]*schema.Relationship, 0, len(cascade))
+		for _, name := range cascade {
+			rel, ok := s.Relationships.Relations[name]
+			if !ok || (rel.Type != schema.HasOne && rel.Type != schema.HasMany) {
+				return fmt.Errorf("%s is not a has one or has many association of %s", name, s.Name)
+			}
+			if _, ok := reflect.New(rel.FieldSchema.ModelType).Interface().(model.SoftDeletable); !ok {
+				return fmt.Errorf("%s of %s cannot be cascaded to: %w", name, s.Name, repository.ErrNotSoftDeletable)
+			}
+			relations = append(relations, rel)
+		}
+
+		if err := db.Clauses(deletedBy).Delete(m).Error; err != nil {
+			return err
+		}
+		parent := redirectReflectPtrToElem(reflect.ValueOf(m))
+		if field := s.LookUpField(model.DeletedByColumn); field != nil {
+			if err := field.Set(ctx, parent, actor); err != nil {
+				return err
+			}
+		}
+
+		for _, rel := range relations {
+			child := reflect.New(rel.FieldSchema.ModelType).Interface()
+			q := db.Model(child).Clauses(clause.Where{Exprs: rel.ToQueryConditions(ctx, parent)}, deletedBy)
+			if err := q.Delete(child).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Restore undeletes the soft deleted m with the given id, its cascaded
+// associations stay deleted. A model.Versioned moves to its next version.
+func (r *BaseRepo) Restore(ctx context.Context, m model.Model, id string) error {
+	if _, ok := m.(model.SoftDeletable); !ok {
+		return repository.ErrNotSoftDeletable
+	}
+	if err := r.GetDB(ctx).Unscoped().Where("id = ? AND "+model.DeletedAtColumn+" IS NOT NULL", id).Take(m).Error; err != nil {
+		return findError(err)
+	}
+	q := r.GetDB(ctx).Unscoped().Model(m)
+	restored := map[string]interface{}{
+		model.DeletedAtColumn: nil,
+		model.DeletedByColumn: "",
+	}
+	if versioned, ok := m.(model.Versioned); ok {
+		return r.updateVersion(q, versioned, restored)
+	}
+	return q.Updates(restored).Error
+}
+
+// ForceDelete removes the row of m with the given id, soft deleted or not.
+func (r *BaseRepo) ForceDelete(ctx context.Context, m model.Model, id string) error {
+	if err := r.GetDB(ctx).Unscoped().Where("id = ?", id).Take(m).Error; err != nil {
+		return findError(err)
+	}
+	return r.GetDB(ctx).Unscoped().Delete(m).Error
+}
+
+// PurgeDeletedBefore removes the rows of the table of m soft deleted before
+// the given time, in batches so that no statement locks the whole table. It
+// returns how many rows were removed, also when it fails midway.
+func (r *BaseRepo) PurgeDeletedBefore(ctx context.Context, m model.Model, before time.Time) (int64, error) {
+	if _, ok := m.(model.SoftDeletable); !ok {
+		return 0, repository.ErrNotSoftDeletable
+	}
+	modelType := redirectReflectPtrToElem(reflect.ValueOf(m)).Type()
+	deleted := model.DeletedAtColumn + " IS NOT NULL AND " + model.DeletedAtColumn + " < ?"
+	var purged int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return purged, err
+		}
+		var ids []string
+		err := r.GetDB(ctx).Unscoped().Model(m).
+			Where(deleted, before).
+			Limit(purgeBatchSize).
+			Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return purged, err
+		}
+		// The rows restored since they were selected are left alone.
+		tx := r.GetDB(ctx).Unscoped().Where("id IN ?", ids).Where(deleted, before).Delete(reflect.New(modelType).Interface())
+		if tx.Error != nil {
+			return purged, tx.Error
+		}
+		purged += tx.RowsAffected
+		if len(ids) < purgeBatchSize {
+			return purged, nil
+		}
+	}
+}
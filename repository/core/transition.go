@@ -0,0 +1,98 @@
+package core
+
+import (
+	"context"
+
+	"github.com/best-expendables-v2/common-utils/model"
+	"github.com/best-expendables-v2/common-utils/repository"
+	"github.com/best-expendables-v2/common-utils/statemachine"
+	"github.com/best-expendables-v2/common-utils/transaction"
+	"gorm.io/gorm/clause"
+)
+
+// SetStateMachines makes Transition look the state machines up in registry
+// instead of the one of statemachine.Register.
+func (r *BaseRepo) SetStateMachines(registry *statemachine.Registry) {
+	r.machines = registry
+}
+
+// Transition moves m to status following the state machine registered for
+// its type. The UPDATE only applies to the status m was read with, so a
+// concurrent transition makes it fail with repository.TransitionNotApplicable.
+// A model.Versioned is also checked and moved to its next version as by
+// Updates, failing with repository.ErrStaleRecord when it changed meanwhile.
+func (r *BaseRepo) Transition(ctx context.Context, m model.Stateful, status string) error {
+	lookup := statemachine.Lookup
+	if r.machines != nil {
+		lookup = r.machines.Lookup
+	}
+	machine, err := lookup(m)
+	if err != nil {
+		return err
+	}
+	from := m.GetStatus()
+	versioned, isVersioned := m.(model.Versioned)
+	var version int64
+	if isVersioned {
+		version = versioned.GetVersion()
+	}
+	t, err := machine.Find(from, status)
+	if err != nil {
+		return err
+	}
+
+	err = transaction.NewTxManager(r.GetDB(ctx)).RunInTx(ctx, func(ctx context.Context) error {
+		if err := t.Check(ctx, m, from); err != nil {
+			return err
+		}
+		if err := t.RunBefore(ctx, m, from); err != nil {
+			return err
+		}
+		db := r.GetDB(ctx)
+		q := db.Model(m).
+			Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: machine.Column()}, Value: from})
+		params := map[string]interface{}{machine.Column(): status}
+		if isVersioned {
+			versioned.SetVersion(version)
+			if err := r.updateVersion(q, versioned, params); err != nil {
+				return err
+			}
+		} else {
+			tx := q.Updates(params)
+			if tx.Error != nil {
+				return tx.Error
+			}
+			if tx.RowsAffected == 0 {
+				return repository.TransitionNotApplicable
+			}
+		}
+		m.SetStatus(status)
+
+		if machine.HistoryTable() != "" {
+			s, err := parseSchema(db, m)
+			if err != nil {
+				return err
+			}
+			history := &statemachine.History{
+				EntityType: s.Table,
+				EntityID:   m.GetID(),
+				FromStatus: from,
+				ToStatus:   status,
+			}
+			if err := db.Table(machine.HistoryTable()).Create(history).Error; err != nil {
+				return err
+			}
+		}
+		transaction.AfterCommit(ctx, func() {
+			t.RunAfter(ctx, m, from)
+		})
+		return nil
+	})
+	if err != nil {
+		m.SetStatus(from)
+		if isVersioned {
+			versioned.SetVersion(version)
+		}
+	}
+	return err
+}
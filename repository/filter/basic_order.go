@@ -43,7 +43,6 @@ func (s BasicOrder) assignTableToOrderByClause(orderByClause string) string {
 		return ""
 	}
 	for object, field := range s.mapObjectToFieldOrder {
-		fmt.Println(object, words[0])
 		if object == words[0] {
 			return fmt.Sprintf("%s %s", field, words[1])
 		}
@@ -0,0 +1,194 @@
+package filter
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ErrWeakSecret is returned by NewCursorFilter for secrets shorter than a
+// SHA-256 key, cursors signed with them could be forged.
+var ErrWeakSecret = errors.New("cursor secret must be at least 32 bytes")
+
+const (
+	defaultTieBreaker = "id"
+	minSecretLength   = sha256.Size
+)
+
+// OrderKey is a column of a keyset ordering.
+type OrderKey struct {
+	Column string
+	Desc   bool
+}
+
+func (k OrderKey) String() string {
+	if k.Desc {
+		return k.Column + " desc"
+	}
+	return k.Column + " asc"
+}
+
+// Cursor holds the sort keys of the row a page starts after. Backward cursors
+// read the page before that row.
+type Cursor struct {
+	Values   []interface{} `json:"v"`
+	Backward bool          `json:"b,omitempty"`
+	Order    string        `json:"o"`
+}
+
+// Page tells how to reach the pages around the one returned by SearchPage,
+// a cursor is empty when there is no such page.
+type Page struct {
+	NextCursor string `json:"nextCursor,omitempty"`
+	PrevCursor string `json:"prevCursor,omitempty"`
+}
+
+// CursorFilter pages with keyset conditions on the ordered columns instead of
+// OFFSET. Cursors are opaque and signed with secret, so clients cannot forge
+// the conditions they carry.
+type CursorFilter struct {
+	BasicFilter `json:"basicFilter"`
+	BasicOrder  `json:"basicOrder"`
+	Cursor      string `json:"cursor"`
+	PerPage     int    `json:"perPage"`
+	// TieBreaker is a unique column ordered last so that every row has a
+	// distinct position, id of the searched table by default.
+	TieBreaker string `json:"-"`
+	secret     []byte
+}
+
+// NewCursorFilter only orders by the objects of mapObjectToFieldOrder, as
+// BasicOrder.SetOrderBy does. The secret must be at least 32 bytes.
+func NewCursorFilter(secret []byte, mapObjectToFieldOrder map[string]string) (*CursorFilter, error) {
+	if len(secret) < minSecretLength {
+		return nil, ErrWeakSecret
+	}
+	f := &CursorFilter{
+		BasicFilter: *NewBasicFilter(),
+		BasicOrder:  *NewBasicOrder(),
+		TieBreaker:  defaultTieBreaker,
+		secret:      secret,
+	}
+	f.allowObjectToOrder(mapObjectToFieldOrder)
+	return f, nil
+}
+
+func (f *CursorFilter) GetPerPage() int {
+	if f.PerPage < 1 || f.PerPage > maxPerPage {
+		return defaultPerPage
+	}
+	return f.PerPage
+}
+
+// GetLimit reads one more row than a page to know whether another follows.
+func (f *CursorFilter) GetLimit() int {
+	return f.GetPerPage() + 1
+}
+
+func (f *CursorFilter) GetOffset() int {
+	return 0
+}
+
+func (f *CursorFilter) GetOrderBy() []string {
+	keys := f.OrderKeys()
+	orderBy := make([]string, len(keys))
+	for i, key := range keys {
+		orderBy[i] = key.String()
+	}
+	return orderBy
+}
+
+func (f *CursorFilter) GetTieBreaker() string {
+	if f.TieBreaker == "" {
+		return defaultTieBreaker
+	}
+	return f.TieBreaker
+}
+
+// OrderKeys returns the whitelisted ordering followed by the tie-breaker.
+func (f *CursorFilter) OrderKeys() []OrderKey {
+	var keys []OrderKey
+	tieBreaker := f.GetTieBreaker()
+	hasTieBreaker := false
+	for _, clause := range f.BasicOrder.SetOrderBy(f.mapObjectToFieldOrder) {
+		words := strings.Split(clause, " ")
+		key := OrderKey{Column: words[0], Desc: strings.EqualFold(words[1], "desc")}
+		hasTieBreaker = hasTieBreaker || key.Column == tieBreaker
+		keys = append(keys, key)
+	}
+	if !hasTieBreaker {
+		desc := len(keys) > 0 && keys[len(keys)-1].Desc
+		keys = append(keys, OrderKey{Column: tieBreaker, Desc: desc})
+	}
+	return keys
+}
+
+func (f *CursorFilter) orderSignature() string {
+	return strings.Join(f.GetOrderBy(), ",")
+}
+
+// EncodeCursor signs a cursor for the current ordering.
+func (f *CursorFilter) EncodeCursor(values []interface{}, backward bool) (string, error) {
+	payload, err := json.Marshal(Cursor{Values: values, Backward: backward, Order: f.orderSignature()})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(f.sign(payload)), nil
+}
+
+// DecodeCursor returns nil for the first page, and ErrInvalidCursor when the
+// cursor was tampered with or made for another ordering.
+func (f *CursorFilter) DecodeCursor() (*Cursor, error) {
+	if f.Cursor == "" {
+		return nil, nil
+	}
+	parts := strings.Split(f.Cursor, ".")
+	if len(parts) != 2 {
+		return nil, ErrInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, f.sign(payload)) {
+		return nil, ErrInvalidCursor
+	}
+	var cursor Cursor
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if cursor.Order != f.orderSignature() || len(cursor.Values) != len(f.OrderKeys()) {
+		return nil, ErrInvalidCursor
+	}
+	for i, value := range cursor.Values {
+		if number, ok := value.(json.Number); ok {
+			cursor.Values[i] = numberValue(number)
+		}
+	}
+	return &cursor, nil
+}
+
+func numberValue(number json.Number) interface{} {
+	if i, err := number.Int64(); err == nil {
+		return i
+	}
+	if f, err := number.Float64(); err == nil {
+		return f
+	}
+	return number.String()
+}
+
+func (f *CursorFilter) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, f.secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
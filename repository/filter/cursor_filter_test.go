@@ -0,0 +1,64 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var secret = []byte("0123456789abcdef0123456789abcdef")
+
+func newCursorFilter(t *testing.T, secret []byte, mapObjectToFieldOrder map[string]string) *CursorFilter {
+	f, err := NewCursorFilter(secret, mapObjectToFieldOrder)
+	require.NoError(t, err)
+	return f
+}
+
+func TestNewCursorFilter_WeakSecret(t *testing.T) {
+	_, err := NewCursorFilter(nil, nil)
+	assert.Equal(t, ErrWeakSecret, err)
+	_, err = NewCursorFilter([]byte("secret"), nil)
+	assert.Equal(t, ErrWeakSecret, err)
+}
+
+func TestCursorFilter_OrderKeys(t *testing.T) {
+	f := newCursorFilter(t, secret, map[string]string{"createdAt": "orders.created_at", "total": "orders.total"})
+	f.OrderBy = []string{"createdAt desc", "total asc", "secret desc", "total; DROP TABLE orders"}
+
+	assert.Equal(t, []OrderKey{
+		{Column: "orders.created_at", Desc: true},
+		{Column: "orders.total"},
+		{Column: "id"},
+	}, f.OrderKeys())
+	assert.Equal(t, []string{"orders.created_at desc", "orders.total asc", "id asc"}, f.GetOrderBy())
+}
+
+func TestCursorFilter_Cursor(t *testing.T) {
+	f := newCursorFilter(t, secret, map[string]string{"total": "total"})
+	f.OrderBy = []string{"total desc"}
+
+	encoded, err := f.EncodeCursor([]interface{}{42, "b"}, true)
+	assert.NoError(t, err)
+
+	f.Cursor = encoded
+	cursor, err := f.DecodeCursor()
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{int64(42), "b"}, cursor.Values)
+	assert.True(t, cursor.Backward)
+
+	f.Cursor = encoded[:len(encoded)-2] + "xx"
+	_, err = f.DecodeCursor()
+	assert.Equal(t, ErrInvalidCursor, err)
+
+	other := newCursorFilter(t, []byte("fedcba9876543210fedcba9876543210"), map[string]string{"total": "total"})
+	other.OrderBy = f.OrderBy
+	other.Cursor = encoded
+	_, err = other.DecodeCursor()
+	assert.Equal(t, ErrInvalidCursor, err)
+
+	f.Cursor = encoded
+	f.OrderBy = []string{"total asc"}
+	_, err = f.DecodeCursor()
+	assert.Equal(t, ErrInvalidCursor, err)
+}
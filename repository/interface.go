@@ -3,15 +3,29 @@ package repository
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/best-expendables-v2/common-utils/repository/filter"
 
 	"github.com/best-expendables-v2/common-utils/model"
+	"github.com/best-expendables-v2/common-utils/service"
 )
 
 var RecordNotFound = errors.New("record not found")
 var TransitionNotApplicable = errors.New("cannot transition to the given status")
 
+var ErrNotIterable = errors.New("repository cannot iterate")
+
+var ErrNotSoftDeletable = errors.New("model does not support soft delete")
+
+// ErrStaleRecord is returned when a model.Versioned was changed or deleted
+// since it was read. It is a service.ConflictError, answered with a 409.
+var ErrStaleRecord error = service.ConflictError{Message: "record has been modified since it was read"}
+
+// ErrVersionedUpsert is returned by BulkUpsert for model.Versioned models, an
+// upsert cannot check the version of the rows it updates.
+var ErrVersionedUpsert = errors.New("versioned models cannot be upserted")
+
 type BaseRepo interface {
 	Searchable
 	Updatable
@@ -41,6 +55,11 @@ type Searchable interface {
 	SearchWithPreloadConditionAndCount(ctx context.Context, val interface{}, f filter.Filter, preloadFields ...PreloadField) (int64, error)
 }
 
+// CanSearchPage pages with cursors instead of offsets, see filter.CursorFilter.
+type CanSearchPage interface {
+	SearchPage(ctx context.Context, val interface{}, f *filter.CursorFilter, preloadFields ...string) (filter.Page, error)
+}
+
 type Updatable interface {
 	Update(ctx context.Context, m model.Model, attrs ...interface{}) error
 	Updates(ctx context.Context, m model.Model, params interface{}) error
@@ -58,11 +77,49 @@ type Removable interface {
 	DeleteByID(ctx context.Context, m model.Model, id string) error
 }
 
+// Iterable walks large result sets without loading them at once.
+type Iterable interface {
+	Iterate(ctx context.Context, val interface{}, f filter.Filter, batchSize int, fn func(batch interface{}) error) error
+	Rows(ctx context.Context, val interface{}, f filter.Filter) (Rows, error)
+}
+
+// Rows is a single pass cursor over the rows of a query, it must be closed.
+type Rows interface {
+	Next() bool
+	Scan(dest interface{}) error
+	Err() error
+	Close() error
+}
+
+// SoftRemovable manages the rows of model.SoftDeletable models.
+type SoftRemovable interface {
+	Restore(ctx context.Context, m model.Model, id string) error
+	ForceDelete(ctx context.Context, m model.Model, id string) error
+	PurgeDeletedBefore(ctx context.Context, m model.Model, before time.Time) (int64, error)
+}
+
+// BulkResult is what a bulk write did, RowsAffected as the database counts it.
+type BulkResult struct {
+	RowsAffected int64
+	IDs          []string
+}
+
+type BulkWritable interface {
+	BulkInsert(ctx context.Context, arr []model.Model) (BulkResult, error)
+	BulkUpsert(ctx context.Context, arr []model.Model, conflictColumns []string, updateColumns ...string) (BulkResult, error)
+	BulkUpdate(ctx context.Context, arr []model.Model, columns ...string) (BulkResult, error)
+}
+
 type CanFindByID interface {
 	FindByID(ctx context.Context, m model.Model, id string, preloadFields ...string) error
 	FindByIDWithPreloadCondition(ctx context.Context, m model.Model, id string, preloadFields ...PreloadField) error
 }
 
+// Transitionable moves models between statuses, see package statemachine.
+type Transitionable interface {
+	Transition(ctx context.Context, m model.Stateful, status string) error
+}
+
 type CanCreateOrUpdate interface {
 	CreateOrUpdate(ctx context.Context, m model.Model, query interface{}, attrs ...interface{}) error
 }
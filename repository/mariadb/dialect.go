@@ -0,0 +1,54 @@
+package mariadb
+
+import (
+	"strings"
+
+	"github.com/best-expendables-v2/common-utils/repository/core"
+)
+
+var _ core.Dialect = Dialect{}
+
+type Dialect struct{}
+
+func (Dialect) Name() string {
+	return "mysql"
+}
+
+func (Dialect) Quote(identifier string) string {
+	parts := strings.Split(identifier, ".")
+	for i, part := range parts {
+		parts[i] = "`" + strings.ReplaceAll(part, "`", "``") + "`"
+	}
+	return strings.Join(parts, ".")
+}
+
+// UpsertClause ignores conflictColumns, MariaDB updates on any unique key.
+func (d Dialect) UpsertClause(conflictColumns, updateColumns []string) string {
+	if len(updateColumns) == 0 {
+		// Assigning a column to itself keeps the row untouched.
+		column := "id"
+		if len(conflictColumns) > 0 {
+			column = conflictColumns[0]
+		}
+		return "ON DUPLICATE KEY UPDATE " + d.Quote(column) + " = " + d.Quote(column)
+	}
+	sets := make([]string, len(updateColumns))
+	for i, column := range updateColumns {
+		sets[i] = d.Quote(column) + " = VALUES(" + d.Quote(column) + ")"
+	}
+	return "ON DUPLICATE KEY UPDATE " + strings.Join(sets, ",")
+}
+
+// SupportsReturning is false as MySQL has no RETURNING, even though recent
+// MariaDB releases support it for INSERT.
+func (Dialect) SupportsReturning() bool {
+	return false
+}
+
+func (Dialect) ReturningClause(columns ...string) string {
+	return ""
+}
+
+func (Dialect) MaxPlaceholders() int {
+	return 65535
+}
@@ -1,9 +1,15 @@
 package postgresql
 
 import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/best-expendables-v2/common-utils/repository/filter"
+	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"testing"
 )
 
 func TestBaseRepo_Updates(t *testing.T) {
@@ -38,3 +44,47 @@ type ShippingProvider struct {
 	CreatedBy string `json:"createdBy"`
 	UpdatedBy string `json:"updatedBy"`
 }
+
+func openMockDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	rawDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open mock sql db, got error: %v", err)
+	}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: rawDB}), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, mock
+}
+
+func TestBaseRepo_SearchOrWhereGroup(t *testing.T) {
+	db, mock := openMockDB(t)
+	repo := NewBaseRepo(db)
+	f := filter.NewPaginationFilter()
+	f.AddWhere("active", "active = ?", true)
+	f.AddOrWhereGroup("slug", "slug = ?", "dhl")
+
+	mock.ExpectQuery(`SELECT \* FROM "shipping_providers" WHERE active = \$1 OR slug = \$2`).
+		WithArgs(true, "dhl").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("1"))
+
+	var providers []ShippingProvider
+	assert.NoError(t, repo.Search(context.Background(), &providers, f))
+	assert.Len(t, providers, 1)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBaseRepo_SearchIsCancelledWithContext(t *testing.T) {
+	db, mock := openMockDB(t)
+	repo := NewBaseRepo(db)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	mock.ExpectQuery(`SELECT`).WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	var providers []ShippingProvider
+	err := repo.Search(ctx, &providers, filter.NewPaginationFilter())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "canceling query")
+}
@@ -0,0 +1,54 @@
+package postgresql
+
+import (
+	"strings"
+
+	"github.com/best-expendables-v2/common-utils/repository/core"
+)
+
+var _ core.Dialect = Dialect{}
+
+type Dialect struct{}
+
+func (Dialect) Name() string {
+	return "postgres"
+}
+
+func (Dialect) Quote(identifier string) string {
+	parts := strings.Split(identifier, ".")
+	for i, part := range parts {
+		parts[i] = `"` + strings.ReplaceAll(part, `"`, `""`) + `"`
+	}
+	return strings.Join(parts, ".")
+}
+
+func (d Dialect) UpsertClause(conflictColumns, updateColumns []string) string {
+	conflict := make([]string, len(conflictColumns))
+	for i, column := range conflictColumns {
+		conflict[i] = d.Quote(column)
+	}
+	if len(updateColumns) == 0 {
+		return "ON CONFLICT (" + strings.Join(conflict, ",") + ") DO NOTHING"
+	}
+	sets := make([]string, len(updateColumns))
+	for i, column := range updateColumns {
+		sets[i] = d.Quote(column) + " = EXCLUDED." + d.Quote(column)
+	}
+	return "ON CONFLICT (" + strings.Join(conflict, ",") + ") DO UPDATE SET " + strings.Join(sets, ",")
+}
+
+func (Dialect) SupportsReturning() bool {
+	return true
+}
+
+func (d Dialect) ReturningClause(columns ...string) string {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = d.Quote(column)
+	}
+	return "RETURNING " + strings.Join(quoted, ",")
+}
+
+func (Dialect) MaxPlaceholders() int {
+	return 65535
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/best-expendables-v2/common-utils/model"
+	"github.com/best-expendables-v2/common-utils/repository/filter"
+)
+
+// ModelPtr is satisfied by *T when T implements model.Model through pointer
+// receivers, as models embedding model.BaseModel do.
+type ModelPtr[T any] interface {
+	*T
+	model.Model
+}
+
+// Repo is a type-safe layer over a BaseRepo, e.g.
+// repository.NewRepo[Product](postgresql.NewBaseRepo(db)). Unscoped reads and
+// the transaction carried by ctx behave as with the BaseRepo.
+type Repo[T any, PT ModelPtr[T]] struct {
+	base BaseRepo
+}
+
+func NewRepo[T any, PT ModelPtr[T]](base BaseRepo) *Repo[T, PT] {
+	return &Repo[T, PT]{base: base}
+}
+
+// Base gives access to the methods Repo does not wrap.
+func (r *Repo[T, PT]) Base() BaseRepo {
+	return r.base
+}
+
+func (r *Repo[T, PT]) FindByID(ctx context.Context, id string, preloadFields ...string) (*T, error) {
+	var m T
+	if err := r.base.FindByID(ctx, PT(&m), id, preloadFields...); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (r *Repo[T, PT]) Search(ctx context.Context, f filter.Filter, preloadFields ...string) ([]T, error) {
+	var result []T
+	if err := r.base.Search(ctx, &result, f, preloadFields...); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (r *Repo[T, PT]) SearchAndCount(ctx context.Context, f filter.Filter, preloadFields ...string) ([]T, int64, error) {
+	var result []T
+	count, err := r.base.SearchAndCount(ctx, &result, f, preloadFields...)
+	if err != nil {
+		return nil, 0, err
+	}
+	return result, count, nil
+}
+
+// Iterate calls fn with batches of at most batchSize models matching f, in
+// primary key order, when the BaseRepo is Iterable.
+func (r *Repo[T, PT]) Iterate(ctx context.Context, f filter.Filter, batchSize int, fn func(batch []T) error) error {
+	iterable, ok := r.base.(Iterable)
+	if !ok {
+		return ErrNotIterable
+	}
+	var batch []T
+	return iterable.Iterate(ctx, &batch, f, batchSize, func(interface{}) error {
+		return fn(batch)
+	})
+}
+
+func (r *Repo[T, PT]) Create(ctx context.Context, m *T) error {
+	return r.base.Create(ctx, PT(m))
+}
+
+func (r *Repo[T, PT]) Update(ctx context.Context, m *T, attrs ...interface{}) error {
+	return r.base.Update(ctx, PT(m), attrs...)
+}
+
+func (r *Repo[T, PT]) Delete(ctx context.Context, id string) error {
+	var m T
+	return r.base.DeleteByID(ctx, PT(&m), id)
+}
@@ -0,0 +1,108 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/best-expendables-v2/common-utils/model"
+	"github.com/best-expendables-v2/common-utils/repository"
+	"github.com/best-expendables-v2/common-utils/repository/filter"
+	"github.com/best-expendables-v2/common-utils/repository/mariadb"
+	"github.com/best-expendables-v2/common-utils/repository/postgresql"
+	"github.com/best-expendables-v2/common-utils/transaction"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type product struct {
+	model.BaseModel
+	Name string
+}
+
+func openRepo(t *testing.T) (*repository.Repo[product, *product], *gorm.DB, sqlmock.Sqlmock) {
+	rawDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open mock sql db, got error: %v", err)
+	}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: rawDB}), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repository.NewRepo[product](postgresql.NewBaseRepo(db)), db, mock
+}
+
+func TestRepo_FindByID(t *testing.T) {
+	repo, _, mock := openRepo(t)
+	mock.ExpectQuery(`SELECT \* FROM "products" WHERE id = \$1`).WithArgs("1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow("1", "book"))
+	mock.ExpectQuery(`SELECT \* FROM "products" WHERE id = \$1`).WithArgs("2").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+
+	p, err := repo.FindByID(context.Background(), "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "book", p.Name)
+
+	p, err = repo.FindByID(context.Background(), "2")
+	assert.Equal(t, repository.RecordNotFound, err)
+	assert.Nil(t, p)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepo_SearchAndCount(t *testing.T) {
+	repo, _, mock := openRepo(t)
+	f := filter.NewPaginationFilter()
+	f.AddWhere("name", "name = ?", "book")
+
+	mock.ExpectQuery(`SELECT count\(\*\) FROM "products" WHERE name = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(`SELECT \* FROM "products" WHERE name = \$1`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow("1", "book").AddRow("2", "book"))
+
+	products, count, err := repo.SearchAndCount(context.Background(), f)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	assert.Len(t, products, 2)
+	assert.Equal(t, "2", products[1].Id)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepo_CreateInTransaction(t *testing.T) {
+	repo, db, mock := openRepo(t)
+	mock.ExpectBegin()
+	mock.ExpectExec(`INSERT INTO "products"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	p := &product{Name: "book"}
+	err := transaction.NewTxManager(db).RunInTx(context.Background(), func(ctx context.Context) error {
+		return repo.Create(ctx, p)
+	})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, p.Id)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepo_MariaDB(t *testing.T) {
+	rawDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to open mock sql db, got error: %v", err)
+	}
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: rawDB, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := repository.NewRepo[product](mariadb.NewBaseRepo(db))
+
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM `products`").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("SELECT \\* FROM `products`").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow("1", "book"))
+
+	products, count, err := repo.SearchAndCount(context.Background(), filter.NewPaginationFilter())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	assert.Equal(t, "book", products[0].Name)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -53,6 +53,12 @@ func (f BadRequestError) Error() string {
 	return ServiceError(f).Error()
 }
 
+type ConflictError ServiceError
+
+func (f ConflictError) Error() string {
+	return ServiceError(f).Error()
+}
+
 type InternalServerError ServiceError
 
 func (f InternalServerError) Error() string {
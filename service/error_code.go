@@ -7,6 +7,7 @@ var defaultHttpErrorCode = map[int]string{
 	http.StatusNotFound:            "NotFound",
 	http.StatusUnauthorized:        "Unauthorized",
 	http.StatusBadRequest:          "BadRequest",
+	http.StatusConflict:            "Conflict",
 	http.StatusInternalServerError: "InternalServerError",
 }
 
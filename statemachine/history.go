@@ -0,0 +1,12 @@
+package statemachine
+
+import "github.com/best-expendables-v2/common-utils/model"
+
+// History is a transition recorded in the table given to WithHistory.
+type History struct {
+	model.BaseModel
+	EntityType string `json:"entityType"`
+	EntityID   string `json:"entityId"`
+	FromStatus string `json:"fromStatus"`
+	ToStatus   string `json:"toStatus"`
+}
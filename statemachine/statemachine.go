@@ -0,0 +1,178 @@
+package statemachine
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/best-expendables-v2/common-utils/model"
+	"github.com/best-expendables-v2/common-utils/repository"
+)
+
+const defaultColumn = "status"
+
+var ErrNotRegistered = errors.New("no state machine registered for the model")
+
+// Hook runs while m moves from one status to another. A guard returning an
+// error, e.g. repository.TransitionNotApplicable, prevents the transition.
+type Hook func(ctx context.Context, m model.Stateful, from, to string) error
+
+// AfterHook runs once the transition is committed.
+type AfterHook func(ctx context.Context, m model.Stateful, from, to string)
+
+// Transition allows moving from any of From to To.
+type Transition struct {
+	From   []string
+	To     string
+	Guards []Hook
+	Before []Hook
+	After  []AfterHook
+}
+
+// Machine holds the transitions allowed between the statuses of a model.
+type Machine struct {
+	column       string
+	historyTable string
+	transitions  map[string]map[string]*Transition
+}
+
+type Option func(*Machine)
+
+// WithColumn sets the column holding the status, "status" by default.
+func WithColumn(column string) Option {
+	return func(m *Machine) {
+		m.column = column
+	}
+}
+
+// WithHistory records every transition as a History row of table.
+func WithHistory(table string) Option {
+	return func(m *Machine) {
+		m.historyTable = table
+	}
+}
+
+func New(transitions []Transition, opts ...Option) *Machine {
+	m := &Machine{
+		column:      defaultColumn,
+		transitions: make(map[string]map[string]*Transition),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	for i := range transitions {
+		t := &transitions[i]
+		for _, from := range t.From {
+			if m.transitions[from] == nil {
+				m.transitions[from] = make(map[string]*Transition)
+			}
+			m.transitions[from][t.To] = t
+		}
+	}
+	return m
+}
+
+func (m *Machine) Column() string {
+	return m.column
+}
+
+// HistoryTable is empty when transitions are not recorded.
+func (m *Machine) HistoryTable() string {
+	return m.historyTable
+}
+
+// Find returns the transition from one status to another, or
+// repository.TransitionNotApplicable when there is none.
+func (m *Machine) Find(from, to string) (*Transition, error) {
+	if t, ok := m.transitions[from][to]; ok {
+		return t, nil
+	}
+	return nil, repository.TransitionNotApplicable
+}
+
+func (m *Machine) Can(from, to string) bool {
+	_, err := m.Find(from, to)
+	return err == nil
+}
+
+// Allowed lists the statuses reachable from status, sorted.
+func (m *Machine) Allowed(status string) []string {
+	var allowed []string
+	for to := range m.transitions[status] {
+		allowed = append(allowed, to)
+	}
+	sort.Strings(allowed)
+	return allowed
+}
+
+// Check runs the guards of t for m, currently in from.
+func (t *Transition) Check(ctx context.Context, m model.Stateful, from string) error {
+	for _, guard := range t.Guards {
+		if err := guard(ctx, m, from, t.To); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Transition) RunBefore(ctx context.Context, m model.Stateful, from string) error {
+	for _, hook := range t.Before {
+		if err := hook(ctx, m, from, t.To); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Transition) RunAfter(ctx context.Context, m model.Stateful, from string) {
+	for _, hook := range t.After {
+		hook(ctx, m, from, t.To)
+	}
+}
+
+// Registry maps model types to their state machine.
+type Registry struct {
+	mu       sync.RWMutex
+	machines map[reflect.Type]*Machine
+}
+
+func NewRegistry() *Registry {
+	return &Registry{machines: make(map[reflect.Type]*Machine)}
+}
+
+func (r *Registry) Register(m model.Stateful, machine *Machine) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.machines[modelType(m)] = machine
+}
+
+func (r *Registry) Lookup(m model.Stateful) (*Machine, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if machine, ok := r.machines[modelType(m)]; ok {
+		return machine, nil
+	}
+	return nil, ErrNotRegistered
+}
+
+func modelType(m model.Stateful) reflect.Type {
+	t := reflect.TypeOf(m)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+var defaultRegistry = NewRegistry()
+
+// Register sets the state machine the repositories use for models of the
+// type of m.
+func Register(m model.Stateful, machine *Machine) {
+	defaultRegistry.Register(m, machine)
+}
+
+func Lookup(m model.Stateful) (*Machine, error) {
+	return defaultRegistry.Lookup(m)
+}
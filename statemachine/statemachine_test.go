@@ -0,0 +1,53 @@
+package statemachine
+
+import (
+	"testing"
+
+	"github.com/best-expendables-v2/common-utils/model"
+	"github.com/best-expendables-v2/common-utils/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+type order struct {
+	model.BaseModel
+	Status string
+}
+
+func (o *order) GetStatus() string {
+	return o.Status
+}
+
+func (o *order) SetStatus(status string) {
+	o.Status = status
+}
+
+func TestMachine(t *testing.T) {
+	machine := New([]Transition{
+		{From: []string{"pending"}, To: "paid"},
+		{From: []string{"pending", "paid"}, To: "cancelled"},
+	}, WithColumn("state"))
+
+	assert.Equal(t, "state", machine.Column())
+	assert.Empty(t, machine.HistoryTable())
+	assert.True(t, machine.Can("paid", "cancelled"))
+	assert.False(t, machine.Can("cancelled", "paid"))
+	assert.Equal(t, []string{"cancelled", "paid"}, machine.Allowed("pending"))
+
+	transition, err := machine.Find("pending", "paid")
+	assert.NoError(t, err)
+	assert.Equal(t, "paid", transition.To)
+	_, err = machine.Find("paid", "pending")
+	assert.Equal(t, repository.TransitionNotApplicable, err)
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	_, err := registry.Lookup(&order{})
+	assert.Equal(t, ErrNotRegistered, err)
+
+	machine := New(nil)
+	registry.Register(&order{}, machine)
+	found, err := registry.Lookup(&order{Status: "paid"})
+	assert.NoError(t, err)
+	assert.Same(t, machine, found)
+}
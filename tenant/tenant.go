@@ -0,0 +1,64 @@
+package tenant
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/best-expendables-v2/common-utils/util"
+	userclient "github.com/best-expendables-v2/user-service-client"
+)
+
+const HeaderTenantID = "X-Tenant-ID"
+
+type contextKey string
+
+var tenantKey contextKey = "tenantID"
+
+func ContextWithTenantID(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey, tenantID)
+}
+
+func GetTenantIDFromContext(ctx context.Context) string {
+	tenantID, _ := ctx.Value(tenantKey).(string)
+	return tenantID
+}
+
+// ResolveFunc returns the tenant of a request, or "" when it cannot tell.
+type ResolveFunc func(r *http.Request) string
+
+func FromHeader(header string) ResolveFunc {
+	return func(r *http.Request) string {
+		return r.Header.Get(header)
+	}
+}
+
+// FromUser reads the tenant from the user set in the context by the
+// authentication middleware.
+func FromUser(tenantOf func(user *userclient.User) string) ResolveFunc {
+	return func(r *http.Request) string {
+		user := util.GetUserFromContext(r.Context())
+		if user == nil {
+			return ""
+		}
+		return tenantOf(user)
+	}
+}
+
+// Middleware stores the tenant found by the first resolver that returns one,
+// FromHeader(HeaderTenantID) when no resolver is given.
+func Middleware(resolvers ...ResolveFunc) func(http.Handler) http.Handler {
+	if len(resolvers) == 0 {
+		resolvers = []ResolveFunc{FromHeader(HeaderTenantID)}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, resolve := range resolvers {
+				if tenantID := resolve(r); tenantID != "" {
+					r = r.WithContext(ContextWithTenantID(r.Context(), tenantID))
+					break
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package tenant
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	userclient "github.com/best-expendables-v2/user-service-client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	var tenantID string
+	handler := Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenantID = GetTenantIDFromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(HeaderTenantID, "acme")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, "acme", tenantID)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, "", tenantID)
+}
+
+func TestFromUser(t *testing.T) {
+	resolve := FromUser(func(user *userclient.User) string {
+		return user.PlatformNames[0]
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.Equal(t, "", resolve(req))
+
+	ctx := userclient.ContextWithUser(context.Background(), &userclient.User{PlatformNames: []string{"acme"}})
+	assert.Equal(t, "acme", resolve(req.WithContext(ctx)))
+}
@@ -2,19 +2,51 @@ package transaction
 
 import (
 	"context"
+	"errors"
+	"sync"
+	"time"
+
 	"gorm.io/gorm"
 )
 
+const (
+	defaultMaxAttempts  = 3
+	defaultRetryBackoff = 50 * time.Millisecond
+)
+
 type contextKey string
 
 var tnxKey contextKey = "tnxKey"
+var hooksKey contextKey = "tnxHooksKey"
 
 func GetTnx(ctx context.Context) interface{} {
 	return ctx.Value(tnxKey)
 }
 
+// AfterCommit runs fn once the transaction carried by ctx is committed, or
+// right away when ctx has no transaction. fn is dropped on rollback.
+func AfterCommit(ctx context.Context, fn func()) {
+	hooks, ok := ctx.Value(hooksKey).(*commitHooks)
+	if !ok || GetTnx(ctx) == nil {
+		fn()
+		return
+	}
+	hooks.add(fn)
+}
+
+// IsRetryable reports whether err asks for the whole transaction to be
+// replayed, e.g. connection.RetryableTxError.
+func IsRetryable(err error) bool {
+	var retryable interface{ TxRetryable() bool }
+	return errors.As(err, &retryable) && retryable.TxRetryable()
+}
+
 type TnxManager interface {
 	Start(ctx context.Context) (Transaction, context.Context)
+	// RunInTx runs fn in a transaction and commits it, replaying the whole
+	// closure when it fails with a retryable error. When ctx already carries
+	// a transaction fn joins it and is not retried on its own.
+	RunInTx(ctx context.Context, fn func(ctx context.Context) error) error
 }
 
 type Transaction interface {
@@ -23,15 +55,49 @@ type Transaction interface {
 	Finish(err error) error
 }
 
+type commitHooks struct {
+	mu  sync.Mutex
+	fns []func()
+}
+
+func (h *commitHooks) add(fn func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fns = append(h.fns, fn)
+}
+
+func (h *commitHooks) run() {
+	h.mu.Lock()
+	fns := h.fns
+	h.fns = nil
+	h.mu.Unlock()
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+func (h *commitHooks) discard() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fns = nil
+}
+
 type transaction struct {
-	tnx *gorm.DB
+	tnx   *gorm.DB
+	hooks *commitHooks
 }
 
 func (t transaction) Commit() error {
-	return t.tnx.Commit().Error
+	if err := t.tnx.Commit().Error; err != nil {
+		t.hooks.discard()
+		return err
+	}
+	t.hooks.run()
+	return nil
 }
 
 func (t transaction) RollBack() {
+	t.hooks.discard()
 	t.tnx.Rollback()
 }
 func (t transaction) Finish(err error) error {
@@ -43,23 +109,105 @@ func (t transaction) Finish(err error) error {
 		t.RollBack()
 		return err
 	}
-	return t.tnx.Commit().Error
+	return t.Commit()
 }
 
 type tnxManager struct {
-	db *gorm.DB
+	db          func(ctx context.Context) *gorm.DB
+	maxAttempts int
+	backoff     func(attempt int) time.Duration
+	retryable   func(err error) bool
 }
 
-func NewTxManager(db *gorm.DB) TnxManager {
-	return tnxManager{db: db}
+type TxOption func(*tnxManager)
+
+// WithMaxAttempts bounds how many times RunInTx runs its closure.
+func WithMaxAttempts(attempts int) TxOption {
+	return func(t *tnxManager) {
+		t.maxAttempts = attempts
+	}
+}
+
+// WithRetryBackoff sets the wait before replaying a transaction, attempt starts at 0.
+func WithRetryBackoff(backoff func(attempt int) time.Duration) TxOption {
+	return func(t *tnxManager) {
+		t.backoff = backoff
+	}
+}
+
+// WithRetryable replaces IsRetryable to decide which errors replay a transaction.
+func WithRetryable(retryable func(err error) bool) TxOption {
+	return func(t *tnxManager) {
+		t.retryable = retryable
+	}
+}
+
+func NewTxManager(db *gorm.DB, opts ...TxOption) TnxManager {
+	return NewTxManagerFunc(func(ctx context.Context) *gorm.DB { return db }, opts...)
+}
+
+// NewTxManagerFunc starts transactions on the database returned by db, e.g.
+// the one of the tenant carried by ctx.
+func NewTxManagerFunc(db func(ctx context.Context) *gorm.DB, opts ...TxOption) TnxManager {
+	t := tnxManager{
+		db:          db,
+		maxAttempts: defaultMaxAttempts,
+		backoff: func(attempt int) time.Duration {
+			return defaultRetryBackoff << uint(attempt)
+		},
+		retryable: IsRetryable,
+	}
+	for _, opt := range opts {
+		opt(&t)
+	}
+	return t
 }
 
 func (t tnxManager) Start(ctx context.Context) (Transaction, context.Context) {
 	if GetTnx(ctx) != nil {
 		return DummyTransaction{}, ctx
 	}
-	tnx := t.db.Begin()
-	return transaction{tnx: tnx}, context.WithValue(ctx, tnxKey, tnx)
+	tnx := t.db(ctx).Begin()
+	hooks := &commitHooks{}
+	ctx = context.WithValue(ctx, hooksKey, hooks)
+	return transaction{tnx: tnx, hooks: hooks}, context.WithValue(ctx, tnxKey, tnx)
+}
+
+func (t tnxManager) RunInTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if GetTnx(ctx) != nil {
+		return fn(ctx)
+	}
+	for attempt := 0; ; attempt++ {
+		err := t.runOnce(ctx, fn)
+		if err == nil || attempt+1 >= t.maxAttempts || !t.retryable(err) {
+			return err
+		}
+		timer := time.NewTimer(t.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+func (t tnxManager) runOnce(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	tx, txCtx := t.Start(ctx)
+	if err := tx.(transaction).tnx.Error; err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.RollBack()
+			panic(r)
+		}
+	}()
+	if err = fn(txCtx); err != nil {
+		tx.RollBack()
+		return err
+	}
+	return tx.Commit()
 }
 
 // Dummy Transaction - Support Multiple Level Transaction
@@ -1,6 +1,7 @@
 package response
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/best-expendables-v2/common-utils/service"
@@ -18,6 +19,12 @@ func ConvertServiceError(err error) ApiResponse {
 		return ErrorResponse(service.ServiceError(err.(service.Unauthorized)), http.StatusUnauthorized)
 	case service.BadRequestError:
 		return ErrorResponse(service.ServiceError(err.(service.BadRequestError)), http.StatusBadRequest)
+	case service.ConflictError:
+		return ErrorResponse(service.ServiceError(err.(service.ConflictError)), http.StatusConflict)
+	}
+	var conflict service.ConflictError
+	if errors.As(err, &conflict) {
+		return ErrorResponse(service.ServiceError(conflict), http.StatusConflict)
 	}
 	return ErrorResponse(err, http.StatusInternalServerError)
 }
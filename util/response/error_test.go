@@ -0,0 +1,26 @@
+package response_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/best-expendables-v2/common-utils/repository"
+	"github.com/best-expendables-v2/common-utils/service"
+	"github.com/best-expendables-v2/common-utils/util/response"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertServiceError_Conflict(t *testing.T) {
+	res := response.ConvertServiceError(service.ConflictError{Code: "OrderPaid", Message: "order is paid"})
+	assert.Equal(t, http.StatusConflict, res.Code)
+	assert.Equal(t, response.Error{Message: "order is paid", Code: "OrderPaid", StatusCode: http.StatusConflict}, res.Errors)
+
+	res = response.ConvertServiceError(fmt.Errorf("saving order: %w", repository.ErrStaleRecord))
+	assert.Equal(t, http.StatusConflict, res.Code)
+	assert.Equal(t, response.Error{
+		Message:    "record has been modified since it was read",
+		Code:       "Conflict",
+		StatusCode: http.StatusConflict,
+	}, res.Errors)
+}